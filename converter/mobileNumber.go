@@ -13,10 +13,9 @@ var austrianMobileProviders = []string{
 	"0676", // Magenta
 	"0678", // Magenta (was UPC)
 	"0660", // 3 Drei.
-	"0699", // 3 Drei.
+	"0699", // 3 Drei., yesss
 	"0650", // tele.ring
 	"0680", // bob
-	"0699", // yesss
 	"0681", // yesss
 	"0667", // m:tel
 }
@@ -38,7 +37,8 @@ func GetMobileNumber(input string) (string, error) {
 
 // PrepareMobileNumber returns 0043664.... and nil when
 // input could be treated as mobile number. The input parameter
-// can either be a string, int or float64 value
+// can either be a string, int or float64 value. Numbers of other countries
+// than Austria need a leading + or 00, see NormalizePhoneNumber otherwise.
 func PrepareMobileNumber(input interface{}) (string, error) {
 	var mobileNumber string
 	var isString bool
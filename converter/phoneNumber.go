@@ -0,0 +1,189 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// PhoneFormat is the output format of a phone number.
+type PhoneFormat int
+
+const (
+	// FormatE164 is +436642394455
+	FormatE164 PhoneFormat = iota
+	// FormatInternational is 00436642394455, as used by PrepareMobileNumber
+	FormatInternational
+	// FormatNational is 06642394455 with the trunk prefix of the country
+	FormatNational
+)
+
+// PhoneCountry holds the numbering plan of a country.
+type PhoneCountry struct {
+	// CallingCode is the country calling code without + or 00, e.g. "43"
+	CallingCode string
+	// TrunkPrefix is dialed before national numbers, e.g. "0",
+	// empty when the country has none
+	TrunkPrefix string
+	// MobilePrefixes are the beginnings of the national significant
+	// numbers (without trunk prefix) of mobile phones, e.g. "664"
+	MobilePrefixes []string
+}
+
+// DefaultCountry is used by ParsePhoneNumber and NormalizePhoneNumber
+// for national numbers when no country is given.
+var DefaultCountry = "AT"
+
+// PhoneCountries are the known countries by ISO 3166 code. Entries can
+// be added or changed before parsing.
+var PhoneCountries = map[string]PhoneCountry{
+	// see https://www.rtr.at/TKP/was_wir_tun/telekommunikation/nummerierung
+	"AT": {CallingCode: "43", TrunkPrefix: "0", MobilePrefixes: []string{
+		"650", "660", "661", "664", "665", "666", "667", "668", "669", "670",
+		"676", "677", "678", "680", "681", "688", "690", "699"}},
+	"DE": {CallingCode: "49", TrunkPrefix: "0", MobilePrefixes: []string{"15", "16", "17"}},
+	"CH": {CallingCode: "41", TrunkPrefix: "0", MobilePrefixes: []string{"75", "76", "77", "78", "79"}},
+	"LI": {CallingCode: "423", MobilePrefixes: []string{"6", "7"}},
+	"HU": {CallingCode: "36", TrunkPrefix: "06", MobilePrefixes: []string{"20", "30", "31", "50", "70"}},
+	"IT": {CallingCode: "39", MobilePrefixes: []string{"3"}},
+	"FR": {CallingCode: "33", TrunkPrefix: "0", MobilePrefixes: []string{"6", "7"}},
+	"NL": {CallingCode: "31", TrunkPrefix: "0", MobilePrefixes: []string{"6"}},
+	"BE": {CallingCode: "32", TrunkPrefix: "0", MobilePrefixes: []string{"46", "47", "48", "49"}},
+	"LU": {CallingCode: "352", MobilePrefixes: []string{"6"}},
+	"CZ": {CallingCode: "420", MobilePrefixes: []string{"60", "72", "73", "77", "79"}},
+	"SK": {CallingCode: "421", TrunkPrefix: "0", MobilePrefixes: []string{"9"}},
+	"SI": {CallingCode: "386", TrunkPrefix: "0", MobilePrefixes: []string{
+		"30", "31", "40", "41", "51", "64", "65", "68", "69", "70", "71"}},
+	"HR": {CallingCode: "385", TrunkPrefix: "0", MobilePrefixes: []string{"91", "92", "95", "97", "98", "99"}},
+	"PL": {CallingCode: "48", MobilePrefixes: []string{
+		"45", "50", "51", "53", "57", "60", "66", "69", "72", "73", "78", "79", "88"}},
+	"ES": {CallingCode: "34", MobilePrefixes: []string{"6", "7"}},
+	"PT": {CallingCode: "351", MobilePrefixes: []string{"9"}},
+	"SE": {CallingCode: "46", TrunkPrefix: "0", MobilePrefixes: []string{"70", "72", "73", "76", "79"}},
+	"IE": {CallingCode: "353", TrunkPrefix: "0", MobilePrefixes: []string{"8"}},
+	"RO": {CallingCode: "40", TrunkPrefix: "0", MobilePrefixes: []string{"7"}},
+	"GB": {CallingCode: "44", TrunkPrefix: "0", MobilePrefixes: []string{"7"}},
+}
+
+// PhoneNumber is a parsed phone number.
+type PhoneNumber struct {
+	// Country is the ISO 3166 code, e.g. "AT"
+	Country string
+	// CallingCode is the country calling code, e.g. "43"
+	CallingCode string
+	// Number is the national significant number without
+	// trunk prefix, e.g. "6642394455"
+	Number string
+	// Mobile is true for mobile phone numbers, false for landlines
+	Mobile bool
+}
+
+// ParsePhoneNumber parses phone numbers like "+43 664 239 44 55",
+// "0043 (0) 664 2394455" or national numbers like "0664/2394455".
+// National numbers belong to country, DefaultCountry when empty.
+func ParsePhoneNumber(input string, country ...string) (PhoneNumber, error) {
+	var p PhoneNumber
+
+	p.Country = DefaultCountry
+	if len(country) > 0 && country[0] != "" {
+		p.Country = strings.ToUpper(country[0])
+	}
+	c, found := PhoneCountries[p.Country]
+	if !found {
+		return p, fmt.Errorf("unknown country %q", p.Country)
+	}
+
+	// "+43 (0) 664 ..." has an optional trunk prefix in brackets
+	digits, err := GetMobileNumber(strings.Replace(input, "(0)", "", 1))
+	if err != nil {
+		return p, err
+	}
+	if strings.LastIndex(digits, "+") > 0 {
+		return p, fmt.Errorf("phone number %q is invalid", input)
+	}
+
+	switch {
+	case strings.HasPrefix(digits, "+"):
+		p, err = parseInternational(digits[1:])
+	case strings.HasPrefix(digits, "00"):
+		p, err = parseInternational(digits[2:])
+	case c.TrunkPrefix != "" && strings.HasPrefix(digits, c.TrunkPrefix):
+		p.Number = strings.TrimPrefix(digits, c.TrunkPrefix)
+	default:
+		p.Number = digits
+	}
+	if err != nil {
+		return p, fmt.Errorf("phone number %q: %w", input, err)
+	}
+	if p.CallingCode == "" {
+		p.CallingCode = c.CallingCode
+	}
+
+	// E.164 allows 15 digits at most, shorter numbers are no phone numbers
+	if n := len(p.CallingCode) + len(p.Number); n < 8 || n > 15 {
+		return p, fmt.Errorf("phone number %q has %d digits, 8 to 15 are valid", input, n)
+	}
+
+	for _, prefix := range PhoneCountries[p.Country].MobilePrefixes {
+		if strings.HasPrefix(p.Number, prefix) {
+			p.Mobile = true
+			break
+		}
+	}
+	return p, nil
+}
+
+// parseInternational splits digits after + or 00 into
+// the calling code and the national significant number.
+func parseInternational(digits string) (PhoneNumber, error) {
+	// calling codes are prefix free, so the first match is the only one
+	for n := 1; n <= 3 && n < len(digits); n++ {
+		for country, c := range PhoneCountries {
+			if c.CallingCode != digits[:n] {
+				continue
+			}
+			number := digits[n:]
+			if c.TrunkPrefix != "" {
+				// +43 0664... is dialed as +43 664...
+				number = strings.TrimPrefix(number, c.TrunkPrefix)
+			}
+			return PhoneNumber{Country: country, CallingCode: c.CallingCode, Number: number}, nil
+		}
+	}
+	return PhoneNumber{}, fmt.Errorf("unknown country calling code")
+}
+
+// Format returns the phone number in the format given.
+func (p PhoneNumber) Format(f PhoneFormat) string {
+	var b bytes.Buffer
+	switch f {
+	case FormatInternational:
+		b.WriteString("00" + p.CallingCode)
+	case FormatNational:
+		b.WriteString(PhoneCountries[p.Country].TrunkPrefix)
+	default:
+		b.WriteString("+" + p.CallingCode)
+	}
+	b.WriteString(p.Number)
+	return b.String()
+}
+
+// String returns the phone number in the E.164 format.
+func (p PhoneNumber) String() string {
+	return p.Format(FormatE164)
+}
+
+// NormalizePhoneNumber parses the input like ParsePhoneNumber and
+// returns it in the format given.
+//
+// Example:
+//
+//	NormalizePhoneNumber("0151 2345 6789", FormatE164, "DE") // +4915123456789
+//	NormalizePhoneNumber("06 30 123 4567", FormatInternational, "HU") // 0036301234567
+func NormalizePhoneNumber(input string, f PhoneFormat, country ...string) (string, error) {
+	p, err := ParsePhoneNumber(input, country...)
+	if err != nil {
+		return "", err
+	}
+	return p.Format(f), nil
+}
@@ -0,0 +1,87 @@
+package converter
+
+import "testing"
+
+func TestParsePhoneNumber(t *testing.T) {
+	var valid = []struct {
+		input   string
+		country string
+		expect  PhoneNumber
+	}{
+		{"+43 664 239 44 55", "", PhoneNumber{"AT", "43", "6642394455", true}},
+		{"0043 (0) 664 2394455", "", PhoneNumber{"AT", "43", "6642394455", true}},
+		{"0664/2394455", "at", PhoneNumber{"AT", "43", "6642394455", true}},
+		{"01 5880 1234", "AT", PhoneNumber{"AT", "43", "158801234", false}},
+		{"0151 2345 6789", "DE", PhoneNumber{"DE", "49", "15123456789", true}},
+		{"+49 (0)89 1234567", "AT", PhoneNumber{"DE", "49", "891234567", false}},
+		{"079 123 45 67", "CH", PhoneNumber{"CH", "41", "791234567", true}},
+		{"+41 44 668 18 00", "", PhoneNumber{"CH", "41", "446681800", false}},
+		{"06 30 123 4567", "HU", PhoneNumber{"HU", "36", "301234567", true}},
+		{"06 1 234 5678", "HU", PhoneNumber{"HU", "36", "12345678", false}},
+		{"+36 20 123 4567", "", PhoneNumber{"HU", "36", "201234567", true}},
+		{"+423 791 23 45", "", PhoneNumber{"LI", "423", "7912345", true}},
+		{"06 12 34 56 78", "FR", PhoneNumber{"FR", "33", "612345678", true}},
+		{"+39 06 1234 5678", "", PhoneNumber{"IT", "39", "0612345678", false}},
+		{"+39 312 345 6789", "", PhoneNumber{"IT", "39", "3123456789", true}},
+		{"+420 601 234 567", "", PhoneNumber{"CZ", "420", "601234567", true}},
+		// without trunk prefix
+		{"6642394455", "AT", PhoneNumber{"AT", "43", "6642394455", true}},
+	}
+	for _, v := range valid {
+		p, err := ParsePhoneNumber(v.input, v.country)
+		if err != nil {
+			t.Errorf("input: %q but got error: %s", v.input, err.Error())
+			continue
+		}
+		if p != v.expect {
+			t.Errorf("input: %q expected %+v but got: %+v", v.input, v.expect, p)
+		}
+	}
+
+	var invalid = []struct {
+		input   string
+		country string
+	}{
+		{"0664 23", "AT"},
+		{"+43 664 239 44 55 66 77 88", ""},
+		{"+999 1234 5678", ""},
+		{"0664 +2394455", ""},
+		{"0664 2394455", "XX"},
+	}
+	for _, v := range invalid {
+		if p, err := ParsePhoneNumber(v.input, v.country); err == nil {
+			t.Errorf("input: %q expected an error but got: %+v", v.input, p)
+		}
+	}
+}
+
+func TestNormalizePhoneNumber(t *testing.T) {
+	var formats = map[PhoneFormat]string{
+		FormatE164:          "+36301234567",
+		FormatInternational: "0036301234567",
+		FormatNational:      "06301234567",
+	}
+	for _, input := range []string{"06 30 123 4567", "+36 30 123 4567", "0036 30/123-4567"} {
+		for f, expect := range formats {
+			ret, err := NormalizePhoneNumber(input, f, "HU")
+			if err != nil {
+				t.Errorf("input: %q but got error: %s", input, err.Error())
+				continue
+			}
+			if ret != expect {
+				t.Errorf("input: %q format %d expected %s but got: %s", input, f, expect, ret)
+			}
+		}
+	}
+
+	// the default country is used for national numbers
+	defer func(c string) { DefaultCountry = c }(DefaultCountry)
+	DefaultCountry = "CH"
+	if ret, _ := NormalizePhoneNumber("079 123 45 67", FormatInternational); ret != "0041791234567" {
+		t.Errorf("expected 0041791234567 but got: %s", ret)
+	}
+	// countries without trunk prefix keep the number
+	if ret, _ := NormalizePhoneNumber("+39 06 1234 5678", FormatNational); ret != "0612345678" {
+		t.Errorf("expected 0612345678 but got: %s", ret)
+	}
+}
@@ -0,0 +1,188 @@
+package senMlWriter
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// Aggregate is a function which reduces the samples of a key
+// within an aggregation window to one record.
+type Aggregate string
+
+const (
+	AggregateMin   Aggregate = "min"
+	AggregateMax   Aggregate = "max"
+	AggregateAvg   Aggregate = "avg"
+	AggregateLast  Aggregate = "last"
+	AggregateCount Aggregate = "count"
+
+	// AggregateSum adds the values of the window, it is written as SenML Sum
+	AggregateSum Aggregate = "sum"
+)
+
+// Aggregation reduces the samples of a base name to statistics
+// per time window before they are added to the pack.
+type Aggregation struct {
+	// Window is the length of the aggregation window in seconds.
+	// Windows are aligned to the clock, e.g. 60 starts every minute.
+	Window int `json:"window" yaml:"window"`
+
+	// Functions are applied to all numeric keys without an entry
+	// in Keys, default is avg.
+	Functions []Aggregate `json:"functions" yaml:"functions"`
+
+	// Keys holds the functions per key.
+	Keys map[string][]Aggregate `json:"keys" yaml:"keys"`
+}
+
+// window holds the samples of one base name within an aggregation window.
+type window struct {
+	start time.Time
+	keys  map[string]*aggregate
+	meta  map[string]RecordMeta
+}
+
+// aggregate holds the statistics of one key within a window.
+type aggregate struct {
+	count          int
+	min, max, sum  float64
+	last           any
+	numeric, mixed bool
+}
+
+// functions returns the aggregate functions of the key.
+func (a Aggregation) functions(key string) []Aggregate {
+	if f, ok := a.Keys[key]; ok {
+		return f
+	}
+	if len(a.Functions) > 0 {
+		return a.Functions
+	}
+	return []Aggregate{AggregateAvg}
+}
+
+// aggregate adds the data to the aggregation window of the base name.
+// When the time leaves the current window, the window is closed and
+// its statistics are added to the pack. The caller must hold the lock.
+func (h *Handler) aggregate(t time.Time, d map[string]any, meta map[string]RecordMeta, bn string, a Aggregation) {
+	length := time.Duration(a.Window) * time.Second
+	start := t.Truncate(length)
+
+	w, ok := h.windows[bn]
+	for ok && !w.start.Equal(start) {
+		// closeWindow can wait for room in the pack and release the
+		// lock, another Add may have started a new window meanwhile
+		h.closeWindow(bn, true)
+		w, ok = h.windows[bn]
+	}
+	if !ok {
+		w = &window{start: start, keys: make(map[string]*aggregate), meta: make(map[string]RecordMeta)}
+		h.windows[bn] = w
+	}
+
+	for key, v := range d {
+		if m, ok := meta[key]; ok {
+			w.meta[key] = m
+		}
+
+		agg, ok := w.keys[key]
+		if !ok {
+			agg = &aggregate{numeric: isNumeric(v)}
+			w.keys[key] = agg
+		}
+		agg.last = v
+		if agg.numeric != isNumeric(v) {
+			// e.g. "n/a" instead of a number, only the last value is kept
+			agg.mixed = true
+		}
+		if !isNumeric(v) {
+			continue
+		}
+
+		f := toFloat64(v)
+		if agg.count == 0 {
+			agg.min, agg.max = f, f
+		}
+		agg.count++
+		agg.min = math.Min(agg.min, f)
+		agg.max = math.Max(agg.max, f)
+		agg.sum += f
+	}
+}
+
+// closeWindows adds the statistics of all finished windows to the packs,
+// with all set the running windows are closed too. The caller must hold the lock.
+func (h *Handler) closeWindows(all bool) {
+	var baseNames []string
+	for bn, w := range h.windows {
+		a := h.config.Aggregation[bn]
+		if all || !time.Now().Before(w.start.Add(time.Duration(a.Window)*time.Second)) {
+			baseNames = append(baseNames, bn)
+		}
+	}
+	slices.Sort(baseNames)
+
+	for _, bn := range baseNames {
+		h.closeWindow(bn, false)
+	}
+}
+
+// closeWindow adds the statistics of the window of the base name to the pack.
+// Numeric keys are written as <key>_<function>, e.g. speed_avg. Other values
+// keep their key and the last value of the window. See makeRoom for block.
+func (h *Handler) closeWindow(bn string, block bool) {
+	w, ok := h.windows[bn]
+	if !ok {
+		return
+	}
+	delete(h.windows, bn)
+
+	a := h.config.Aggregation[bn]
+	data := make(map[string]any)
+	meta := make(map[string]RecordMeta)
+
+	for key, agg := range w.keys {
+		if !agg.numeric || agg.mixed || agg.count == 0 {
+			data[key] = agg.last
+			meta[key] = w.meta[key]
+			continue
+		}
+
+		for _, f := range a.functions(key) {
+			name := key + "_" + string(f)
+			m := w.meta[key]
+			switch f {
+			case AggregateMin:
+				data[name] = agg.min
+			case AggregateMax:
+				data[name] = agg.max
+			case AggregateAvg:
+				data[name] = agg.sum / float64(agg.count)
+			case AggregateLast:
+				data[name] = toFloat64(agg.last)
+			case AggregateCount:
+				data[name] = agg.count
+				m = RecordMeta{}
+			case AggregateSum:
+				data[name] = agg.sum
+				m.Sum = true
+			default:
+				continue
+			}
+			meta[name] = m
+		}
+	}
+
+	h.append(w.start, data, meta, bn, block)
+}
+
+// isNumeric returns false for the value types written as
+// vb, vs and vd, see setValue.
+func isNumeric(v any) bool {
+	switch v.(type) {
+	case bool, string, []byte:
+		return false
+	}
+	return true
+}
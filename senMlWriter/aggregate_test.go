@@ -0,0 +1,129 @@
+package senMlWriter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregationWindow(t *testing.T) {
+	handler := New(Config{TimePrecision: 3, FlushInterval: 3600, Out: unreachableOut,
+		Aggregation: map[string]Aggregation{"vibration/": {
+			Window:    1,
+			Functions: []Aggregate{AggregateMin, AggregateMax, AggregateAvg},
+			Keys: map[string][]Aggregate{
+				"pulses": {AggregateSum, AggregateCount},
+				"state":  {AggregateLast},
+			},
+		}}})
+	defer handler.Close()
+
+	t0 := time.UnixMilli(1714557600000)
+	for i := 0; i < 20; i++ {
+		handler.AddWithMeta(t0.Add(time.Duration(i)*100*time.Millisecond),
+			map[string]any{"amplitude": float64(i % 10), "pulses": 2, "state": "running"},
+			map[string]RecordMeta{"amplitude": {Unit: "m/s2"}}, "vibration/")
+	}
+
+	handler.Lock()
+	defer handler.Unlock()
+
+	// the second window is still running
+	samples, err := Samples(handler.packs["vibration/"])
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(samples))
+	assert.True(t, t0.Equal(samples[0].Time))
+	assert.Equal(t, 0.0, samples[0].Data.Float64("amplitude_min"))
+	assert.Equal(t, 9.0, samples[0].Data.Float64("amplitude_max"))
+	assert.Equal(t, 4.5, samples[0].Data.Float64("amplitude_avg"))
+	assert.Equal(t, 20.0, samples[0].Data.Float64("pulses_sum"))
+	assert.Equal(t, 10.0, samples[0].Data.Float64("pulses_count"))
+	assert.Equal(t, "running", samples[0].Data.String("state"))
+
+	records, err := Resolve(handler.packs["vibration/"])
+	assert.NoError(t, err)
+	for _, r := range records {
+		switch r["name"] {
+		case "amplitude_avg":
+			assert.Equal(t, "m/s2", r["unit"])
+		case "pulses_sum":
+			assert.Equal(t, 20.0, r["sum"])
+			assert.NotContains(t, r, "value")
+		}
+	}
+
+	// a flush closes the finished second window
+	handler.closeWindows(false)
+	samples, err = Samples(handler.packs["vibration/"])
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(samples))
+	assert.True(t, t0.Add(time.Second).Equal(samples[1].Time))
+	assert.Empty(t, handler.windows)
+}
+
+func TestAggregationRunningWindowKept(t *testing.T) {
+	handler := New(Config{TimePrecision: 3, FlushInterval: 3600, Out: unreachableOut,
+		Aggregation: map[string]Aggregation{"gps/": {Window: 3600}}})
+	defer handler.Close()
+
+	handler.Add(time.Now(), map[string]any{"speed": 10}, "gps/")
+	handler.Add(time.Now(), map[string]any{"speed": 20}, "gps/")
+	handler.Add(time.Now(), map[string]any{"speed": 30}, "other/")
+
+	handler.Lock()
+	handler.closeWindows(false)
+	assert.NotContains(t, handler.packs, "gps/")
+	assert.Contains(t, handler.packs, "other/")
+
+	handler.closeWindows(true)
+	samples, err := Samples(handler.packs["gps/"])
+	handler.Unlock()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(samples))
+	assert.Equal(t, 15.0, samples[0].Data.Float64("speed_avg"))
+}
+
+func TestAggregationWindowStartedWhileBlocked(t *testing.T) {
+	sink := Memory("TestAggregationWindowStartedWhileBlocked")
+	defer sink.Reset()
+	sink.Fail(errors.New("output down"))
+
+	handler := New(Config{TimePrecision: 0, FlushInterval: 3600, MaxRecordsPerPack: 1,
+		OverflowPolicy: OverflowBlock, Out: "memory:TestAggregationWindowStartedWhileBlocked",
+		Aggregation: map[string]Aggregation{"gps/": {Window: 86400, Functions: []Aggregate{AggregateCount}}}})
+
+	now := time.Now()
+	handler.Add(now.Add(-48*time.Hour), map[string]any{"speed": 1.0}, "gps/")
+	// closes the first window, the pack is full
+	handler.Add(now.Add(-24*time.Hour), map[string]any{"speed": 2.0}, "gps/")
+
+	// closing the second window waits for room in the pack
+	blocked := make(chan struct{})
+	go func() {
+		handler.Add(now, map[string]any{"speed": 3.0}, "gps/")
+		close(blocked)
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	// starts the current window while the Add above waits
+	handler.Add(now, map[string]any{"speed": 4.0}, "gps/")
+
+	sink.Fail(nil)
+	assert.NoError(t, handler.Flush())
+	<-blocked
+	assert.NoError(t, handler.Close())
+
+	// both samples of the current window are counted
+	var counts []float64
+	for _, p := range sink.Packs() {
+		samples, err := Samples(p)
+		assert.NoError(t, err)
+		for _, s := range samples {
+			counts = append(counts, s.Data.Float64("speed_count"))
+		}
+	}
+	assert.Equal(t, []float64{1, 1, 2}, counts)
+}
@@ -0,0 +1,100 @@
+package senMlWriter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var ErrUnknownCompression = errors.New("unknown compression")
+
+// Compression is the compression of files written by SenMl2File.
+type Compression string
+
+const (
+	// CompressionNone writes plain files (default)
+	CompressionNone Compression = ""
+
+	// CompressionGzip writes gzip files with the extension .gz
+	CompressionGzip Compression = "gzip"
+
+	// CompressionZstd writes zstandard files with the extension .zst
+	CompressionZstd Compression = "zstd"
+)
+
+// Extension returns the file extension including the dot which is
+// appended to the file name, e.g. ".gz".
+func (c Compression) Extension() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// compress compresses b.
+func (c Compression) compress(b []byte) ([]byte, error) {
+	switch c {
+	case CompressionNone:
+		return b, nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(b); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer enc.Close()
+		return enc.EncodeAll(b, nil), nil
+	}
+	return nil, ErrUnknownCompression
+}
+
+// decompress decompresses b.
+func (c Compression) decompress(b []byte) ([]byte, error) {
+	switch c {
+	case CompressionNone:
+		return b, nil
+	case CompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	case CompressionZstd:
+		dec, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer dec.Close()
+		return dec.DecodeAll(b, nil)
+	}
+	return nil, ErrUnknownCompression
+}
+
+// compressionOf returns the compression of the file and the
+// file name without the compression extension.
+func compressionOf(fileName string) (Compression, string) {
+	for _, c := range []Compression{CompressionGzip, CompressionZstd} {
+		if strings.HasSuffix(fileName, c.Extension()) {
+			return c, strings.TrimSuffix(fileName, filepath.Ext(fileName))
+		}
+	}
+	return CompressionNone, fileName
+}
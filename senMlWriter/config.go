@@ -0,0 +1,253 @@
+package senMlWriter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrInvalidConfig = errors.New("invalid config")
+
+// LoadConfig reads the Config from a JSON or YAML file (depending on its
+// extension .json, .yaml or .yml) and validates it. On a validation
+// error the Config is returned together with all problems found.
+//
+// Example:
+//
+//	cfg, err := LoadConfig("/etc/senml/writer.yaml")
+//	if err != nil {
+//		slog.Error("bad config", "error", err)
+//		os.Exit(1)
+//	}
+//	handler := New(cfg)
+func LoadConfig(file string) (Config, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var c Config
+	switch filepath.Ext(file) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &c)
+	case ".json":
+		err = json.Unmarshal(b, &c)
+	default:
+		err = fmt.Errorf("config file %s: unsupported extension", file)
+	}
+	if err != nil {
+		return Config{}, err
+	}
+	return c, c.Validate()
+}
+
+// Validate checks the outputs and options of the Config and returns all
+// problems found joined into one error, each wrapping ErrInvalidConfig.
+// It does not connect to any output, but reads the key files of the
+// Envelope. Outputs of schemes registered with RegisterOutput are valid
+// when the scheme is registered before Validate.
+func (c Config) Validate() error {
+	var errs []error
+	var fail = func(field string, err error) {
+		errs = append(errs, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, field, err))
+	}
+	var notNegative = func(field string, value int64) {
+		if value < 0 {
+			fail(field, fmt.Errorf("%d is negative", value))
+		}
+	}
+	var oneOf = func(field string, value string, valid ...string) {
+		if value != "" && !slices.Contains(valid, value) {
+			fail(field, fmt.Errorf("%q is not one of %s", value, strings.Join(valid, ", ")))
+		}
+	}
+
+	if c.Out == "" && len(c.Outs) == 0 {
+		fail("out", ErrUnknownOut)
+	}
+	if c.Out != "" {
+		if err := validateOut(c.Out); err != nil {
+			fail("out", err)
+		}
+	}
+	for i, out := range c.Outs {
+		if err := validateOut(out); err != nil {
+			fail(fmt.Sprintf("outs[%d]", i), err)
+		}
+	}
+	if outputs := len(c.outputs()); c.Quorum > outputs {
+		fail("quorum", fmt.Errorf("%d is more than the %d outputs", c.Quorum, outputs))
+	}
+	notNegative("quorum", int64(c.Quorum))
+
+	oneOf("encoding", string(c.Encoding),
+		string(EncodingJSON), string(EncodingCBOR), string(EncodingXML), string(EncodingJSONLines))
+	oneOf("syslogFormat", string(c.SyslogFormat), string(SyslogFormatLegacy), string(SyslogFormatRFC5424))
+	oneOf("file.compression", string(c.File.Compression), string(CompressionGzip), string(CompressionZstd))
+	oneOf("overflowPolicy", string(c.OverflowPolicy),
+		string(OverflowKeep), string(OverflowDropNewest), string(OverflowDropOldest), string(OverflowBlock))
+	oneOf("latePolicy", string(c.LatePolicy), string(LateReject), string(LateClamp))
+
+	notNegative("syslogMaxSize", int64(c.SyslogMaxSize))
+	notNegative("timePrecision", int64(c.TimePrecision))
+	notNegative("flushInterval", int64(c.FlushInterval))
+	notNegative("spoolMaxBytes", c.SpoolMaxBytes)
+	notNegative("spoolMaxAge", int64(c.SpoolMaxAge))
+	notNegative("maxRecordsPerPack", int64(c.MaxRecordsPerPack))
+	notNegative("maxBytesPerPack", int64(c.MaxBytesPerPack))
+	notNegative("watermark", int64(c.Watermark))
+	notNegative("clockJump", int64(c.ClockJump))
+	notNegative("file.maxAge", int64(c.File.MaxAge))
+	notNegative("file.maxBytes", c.File.MaxBytes)
+	if (c.File.MaxAge > 0 || c.File.MaxBytes > 0) && c.File.RetentionDir == "" {
+		fail("file.retentionDir", errors.New("must be set for maxAge and maxBytes"))
+	}
+	notNegative("mqtt.timeout", int64(c.MQTT.Timeout))
+	notNegative("nats.timeout", int64(c.NATS.Timeout))
+	notNegative("http.timeout", int64(c.HTTP.Timeout))
+	notNegative("http.retries", int64(c.HTTP.Retries))
+	notNegative("http.retryDelay", int64(c.HTTP.RetryDelay))
+
+	if c.MQTT.QoS > 2 {
+		fail("mqtt.qos", fmt.Errorf("%d is not 0, 1 or 2", c.MQTT.QoS))
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		fail("tls", errors.New("certFile and keyFile must be set together"))
+	}
+	if n := len(c.Envelope.Key); n > 0 && n != envelopeKeyLen {
+		fail("envelope.key", fmt.Errorf("has %d bytes, AES-256 needs %d", n, envelopeKeyLen))
+	}
+	if c.Envelope.PrivateKeyFile != "" {
+		if _, err := readPrivateKey(c.Envelope.PrivateKeyFile); err != nil {
+			fail("envelope.privateKeyFile", err)
+		}
+	}
+	if c.Envelope.PublicKeyFile != "" {
+		if _, err := readPublicKey(c.Envelope.PublicKeyFile); err != nil {
+			fail("envelope.publicKeyFile", err)
+		}
+	}
+
+	functions := []string{string(AggregateMin), string(AggregateMax), string(AggregateAvg),
+		string(AggregateLast), string(AggregateCount), string(AggregateSum)}
+	for bn, a := range c.Aggregation {
+		field := "aggregation." + bn
+		notNegative(field+".window", int64(a.Window))
+		for _, fn := range a.Functions {
+			oneOf(field+".functions", string(fn), functions...)
+		}
+		for key, fns := range a.Keys {
+			for _, fn := range fns {
+				oneOf(field+".keys."+key, string(fn), functions...)
+			}
+		}
+	}
+	for i, r := range c.Routes {
+		field := fmt.Sprintf("routes[%d]", i)
+		if r.Out != "" {
+			if err := validateOut(r.Out); err != nil {
+				fail(field+".out", err)
+			}
+		}
+		for j, out := range r.Outs {
+			if err := validateOut(out); err != nil {
+				fail(fmt.Sprintf("%s.outs[%d]", field, j), err)
+			}
+		}
+		if outputs := len(c.forBaseName(r.Prefix).outputs()); r.Quorum > outputs {
+			fail(field+".quorum", fmt.Errorf("%d is more than the %d outputs", r.Quorum, outputs))
+		}
+		notNegative(field+".quorum", int64(r.Quorum))
+		notNegative(field+".flushInterval", int64(r.FlushInterval))
+		if r.TimePrecision != nil {
+			notNegative(field+".timePrecision", int64(*r.TimePrecision))
+		}
+		if strings.Contains(r.SyslogTag, "/") {
+			fail(field+".syslogTag", fmt.Errorf("%q contains a slash", r.SyslogTag))
+		}
+	}
+	for key, d := range c.Deadband {
+		field := "deadband." + key
+		if d.Absolute < 0 || d.Percent < 0 {
+			fail(field, errors.New("absolute and percent must not be negative"))
+		}
+		notNegative(field+".maxSilence", int64(d.MaxSilence))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateOut checks the syntax of one output without connecting to it.
+func validateOut(out string) error {
+	name := redact(out)
+	scheme, right, found := strings.Cut(out, ":")
+	if !found || scheme == "" {
+		return fmt.Errorf("%q has no scheme: %w", name, ErrUnknownOut)
+	}
+
+	switch scheme {
+	case "stdout", "stderr":
+		return nil
+	case "file", "influx", "csv":
+		if right == "" {
+			return fmt.Errorf("%q has no file name template", name)
+		}
+		if _, err := template.New("x").Parse(right); err != nil {
+			return fmt.Errorf("%q: %w", name, err)
+		}
+		return nil
+	case "syslog", "syslog+tcp", "syslog+udp", "syslog+tls",
+		"mqtt", "mqtts", "nats", "http", "https":
+		rest, ok := strings.CutPrefix(right, "//")
+		if !ok {
+			return fmt.Errorf("%q must start with %s://", name, scheme)
+		}
+		host, path, _ := strings.Cut(rest, "/")
+		if _, err := template.New("x").Parse(path); err != nil {
+			return fmt.Errorf("%q: %w", name, err)
+		}
+		if i := strings.LastIndex(host, "@"); i >= 0 {
+			host = host[i+1:]
+		}
+		if host == "" {
+			return fmt.Errorf("%q has no host", name)
+		}
+		// syslog needs a port, all others have a default port
+		if _, _, err := net.SplitHostPort(host); err == nil || strings.HasPrefix(scheme, "syslog") {
+			return validateAddress(name, host)
+		}
+		return nil
+	}
+
+	registry.RLock()
+	_, ok := registry.m[scheme]
+	registry.RUnlock()
+	if !ok {
+		return fmt.Errorf("%q: %w", name, ErrUnknownOut)
+	}
+	return nil
+}
+
+// validateAddress checks a host:port address.
+func validateAddress(out, address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%q: %w", out, err)
+	}
+	if host == "" {
+		return fmt.Errorf("%q has no host", out)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return fmt.Errorf("%q has the invalid port %q", out, port)
+	}
+	return nil
+}
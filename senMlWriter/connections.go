@@ -0,0 +1,61 @@
+package senMlWriter
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// connections holds the long-lived output connections of a Handler,
+// keyed by their address, so they are reused between flushes.
+type connections struct {
+	sync.Mutex
+	m map[string]io.Closer
+}
+
+func newConnections() *connections {
+	return &connections{m: make(map[string]io.Closer)}
+}
+
+// get returns the connection for the key or opens a new one.
+func (c *connections) get(key string, open func() (io.Closer, error)) (io.Closer, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if conn, ok := c.m[key]; ok {
+		return conn, nil
+	}
+
+	conn, err := open()
+	if err != nil {
+		return nil, err
+	}
+	c.m[key] = conn
+	return conn, nil
+}
+
+// drop closes and removes the connection of the key.
+func (c *connections) drop(key string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	conn, ok := c.m[key]
+	if !ok {
+		return nil
+	}
+	delete(c.m, key)
+	return conn.Close()
+}
+
+// close closes all connections.
+func (c *connections) close() error {
+	c.Lock()
+	defer c.Unlock()
+
+	var errs []error
+	for key, conn := range c.m {
+		errs = append(errs, conn.Close())
+		delete(c.m, key)
+	}
+	return errors.Join(errs...)
+}
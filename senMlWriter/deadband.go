@@ -0,0 +1,91 @@
+package senMlWriter
+
+import (
+	"bytes"
+	"math"
+	"time"
+)
+
+// Deadband suppresses values of a key which did not change meaningfully
+// since the last written value. Without thresholds a value is written
+// when it changed at all (change-only).
+type Deadband struct {
+	// Absolute is the minimum change of a numeric value.
+	Absolute float64 `json:"absolute" yaml:"absolute"`
+
+	// Percent is the minimum change of a numeric value in percent
+	// of the last written value.
+	Percent float64 `json:"percent" yaml:"percent"`
+
+	// MaxSilence in seconds writes the value even without change when
+	// the last written value is older, 0 means never.
+	MaxSilence int `json:"maxSilence" yaml:"maxSilence"`
+}
+
+// emitted is the last written value of a key.
+type emitted struct {
+	value any
+	time  time.Time
+}
+
+// deadband returns the data without the values suppressed by the
+// deadband of their key. The caller must hold the lock.
+func (h *Handler) deadband(t time.Time, d map[string]any, bn string) map[string]any {
+	if len(h.config.Deadband) == 0 {
+		return d
+	}
+
+	last := h.emitted[bn]
+	if last == nil {
+		last = make(map[string]emitted)
+		h.emitted[bn] = last
+	}
+
+	data := make(map[string]any, len(d))
+	for key, v := range d {
+		db, ok := h.config.Deadband[key]
+		if !ok {
+			data[key] = v
+			continue
+		}
+
+		e, ok := last[key]
+		if ok && !db.exceeded(e, t, v) {
+			continue
+		}
+		data[key] = v
+		last[key] = emitted{value: v, time: t}
+	}
+	return data
+}
+
+// exceeded returns true when the value must be written.
+func (db Deadband) exceeded(e emitted, t time.Time, v any) bool {
+	if db.MaxSilence > 0 && t.Sub(e.time) >= time.Duration(db.MaxSilence)*time.Second {
+		return true
+	}
+
+	if !isNumeric(v) || !isNumeric(e.value) {
+		return !equal(e.value, v)
+	}
+
+	last, f := toFloat64(e.value), toFloat64(v)
+	diff := math.Abs(f - last)
+	if db.Absolute <= 0 && db.Percent <= 0 {
+		return diff != 0
+	}
+	if db.Absolute > 0 && diff >= db.Absolute {
+		return true
+	}
+	return db.Percent > 0 && diff > 0 && diff >= math.Abs(last)*db.Percent/100
+}
+
+// equal compares two values of the types supported by setValue.
+func equal(a, b any) bool {
+	ab, aok := a.([]byte)
+	bb, bok := b.([]byte)
+	if aok || bok {
+		return aok && bok && bytes.Equal(ab, bb)
+	}
+	return a == b
+}
@@ -0,0 +1,71 @@
+package senMlWriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadbandSuppressesSmallChanges(t *testing.T) {
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, Out: unreachableOut,
+		Deadband: map[string]Deadband{
+			"latitude": {Absolute: 0.0001, MaxSilence: 60},
+			"speed":    {Percent: 10},
+			"door":     {},
+		}})
+	defer handler.Close()
+
+	t0 := time.UnixMilli(1714557600000)
+	values := []map[string]any{
+		{"latitude": 47.60000, "speed": 100.0, "door": "closed", "odometer": 1.0},
+		{"latitude": 47.60001, "speed": 105.0, "door": "closed", "odometer": 1.0},
+		{"latitude": 47.60020, "speed": 111.0, "door": "open", "odometer": 1.0},
+		{"latitude": 47.60020, "speed": 111.0, "door": "open", "odometer": 1.0},
+	}
+	for i, v := range values {
+		handler.Add(t0.Add(time.Duration(i)*time.Second), v, "gps/")
+	}
+
+	// the maximum silence writes the unchanged latitude
+	handler.Add(t0.Add(62*time.Second), map[string]any{"latitude": 47.60020}, "gps/")
+
+	handler.Lock()
+	samples, err := Samples(handler.packs["gps/"])
+	handler.Unlock()
+	assert.NoError(t, err)
+
+	// keys without deadband are always written
+	assert.Equal(t, 5, len(samples))
+	assert.Equal(t, map[string]any{"latitude": 47.6, "speed": 100.0, "door": "closed", "odometer": 1.0}, map[string]any(samples[0].Data))
+	assert.Equal(t, map[string]any{"odometer": 1.0}, map[string]any(samples[1].Data))
+	assert.Equal(t, map[string]any{"latitude": 47.6002, "speed": 111.0, "door": "open", "odometer": 1.0}, map[string]any(samples[2].Data))
+	assert.Equal(t, map[string]any{"odometer": 1.0}, map[string]any(samples[3].Data))
+	assert.Equal(t, map[string]any{"latitude": 47.6002}, map[string]any(samples[4].Data))
+}
+
+func TestDeadbandSkipsUnchangedSample(t *testing.T) {
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, Out: unreachableOut,
+		Deadband: map[string]Deadband{"latitude": {}, "longitude": {}}})
+	defer handler.Close()
+
+	t0 := time.Now()
+	for i := 0; i < 10; i++ {
+		handler.Add(t0.Add(time.Duration(i)*time.Second), map[string]any{"latitude": 47.6, "longitude": 17.2}, "gps/")
+	}
+
+	handler.Lock()
+	defer handler.Unlock()
+	assert.Equal(t, 2, len(handler.packs["gps/"].Records))
+}
+
+func TestDeadbandExceeded(t *testing.T) {
+	t0 := time.Now()
+	last := emitted{value: 0.0, time: t0}
+
+	assert.False(t, Deadband{Percent: 10}.exceeded(last, t0, 0.0))
+	assert.True(t, Deadband{Percent: 10}.exceeded(last, t0, 0.1))
+	assert.False(t, Deadband{}.exceeded(emitted{value: []byte{1}, time: t0}, t0, []byte{1}))
+	assert.True(t, Deadband{}.exceeded(emitted{value: []byte{1}, time: t0}, t0, []byte{2}))
+	assert.True(t, Deadband{}.exceeded(emitted{value: true, time: t0}, t0, 1.0))
+}
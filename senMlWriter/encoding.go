@@ -0,0 +1,77 @@
+package senMlWriter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/mainflux/senml"
+)
+
+var ErrUnknownEncoding = errors.New("unknown Encoding")
+
+// Encoding is the format of the written packs.
+type Encoding string
+
+const (
+	// EncodingJSON writes the pack as SenML JSON array (default)
+	EncodingJSON Encoding = "json"
+
+	// EncodingCBOR writes the pack as SenML CBOR
+	EncodingCBOR Encoding = "cbor"
+
+	// EncodingXML writes the pack as SenML XML
+	EncodingXML Encoding = "xml"
+
+	// EncodingJSONLines writes one SenML JSON record per line
+	EncodingJSONLines Encoding = "jsonl"
+)
+
+// Extension returns the file extension without dot, e.g. "cbor".
+// It is available as {{.extension}} in the file name template.
+func (e Encoding) Extension() string {
+	if e == "" {
+		return string(EncodingJSON)
+	}
+	return string(e)
+}
+
+// ContentType returns the media type of the encoding, see RFC 8428.
+func (e Encoding) ContentType() string {
+	switch e {
+	case EncodingCBOR:
+		return "application/senml+cbor"
+	case EncodingXML:
+		return "application/senml+xml"
+	case EncodingJSONLines:
+		return "application/x-ndjson"
+	}
+	return "application/senml+json"
+}
+
+// Encode encodes the pack in the given encoding.
+func (e Encoding) Encode(p senml.Pack) ([]byte, error) {
+	switch e {
+	case "", EncodingJSON:
+		return senml.Encode(p, senml.JSON)
+	case EncodingCBOR:
+		return senml.Encode(p, senml.CBOR)
+	case EncodingXML:
+		return senml.Encode(p, senml.XML)
+	case EncodingJSONLines:
+		var b bytes.Buffer
+		enc := json.NewEncoder(&b)
+		for _, r := range p.Records {
+			if err := enc.Encode(r); err != nil {
+				return nil, err
+			}
+		}
+		return b.Bytes(), nil
+	}
+	return nil, ErrUnknownEncoding
+}
+
+// encode encodes the pack of the writer in the configured encoding.
+func (w *Writer) encode() ([]byte, error) {
+	return w.cfg.Encoding.Encode(w.p)
+}
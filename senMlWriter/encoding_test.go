@@ -0,0 +1,93 @@
+package senMlWriter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mainflux/senml"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPack() senml.Pack {
+	v1, v2 := 22.5, 60.0
+	return senml.Pack{Records: []senml.Record{
+		{BaseName: "environment/", BaseTime: 1714557600, Name: "temperature", Value: &v1},
+		{Name: "humidity", Value: &v2, Time: 1},
+	}}
+}
+
+func TestEncodingRoundTrip(t *testing.T) {
+	formats := map[Encoding]senml.Format{
+		EncodingJSON: senml.JSON,
+		EncodingCBOR: senml.CBOR,
+		EncodingXML:  senml.XML,
+	}
+	for enc, format := range formats {
+		b, err := enc.Encode(testPack())
+		assert.NoError(t, err, enc)
+
+		p, err := senml.Decode(b, format)
+		assert.NoError(t, err, enc)
+		assert.Equal(t, testPack().Records, p.Records, enc)
+	}
+}
+
+func TestEncodingCBORIsSmallerThanJSON(t *testing.T) {
+	j, _ := EncodingJSON.Encode(testPack())
+	c, _ := EncodingCBOR.Encode(testPack())
+	assert.Less(t, len(c), len(j))
+}
+
+func TestEncodingJSONLinesWritesOneRecordPerLine(t *testing.T) {
+	b, err := EncodingJSONLines.Encode(testPack())
+	assert.NoError(t, err)
+
+	var records []senml.Record
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		var r senml.Record
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		records = append(records, r)
+	}
+	assert.Equal(t, testPack().Records, records)
+}
+
+func TestEncodingUnknown(t *testing.T) {
+	_, err := Encoding("yaml").Encode(testPack())
+	assert.ErrorIs(t, err, ErrUnknownEncoding)
+}
+
+func TestSenMl2FileUsesEncodingExtension(t *testing.T) {
+	dir := outputDir(t)
+	w := NewWriter(WriterConfig{Encoding: EncodingCBOR})
+
+	fileName, err := w.AddPack(testPack()).SenMl2File(filepath.Join(dir, "{{.baseName}}.{{.extension}}"))
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "environment.cbor"), fileName)
+
+	b, err := os.ReadFile(fileName)
+	assert.NoError(t, err)
+	p, err := senml.Decode(b, senml.CBOR)
+	assert.NoError(t, err)
+	assert.Equal(t, testPack().Records, p.Records)
+}
+
+func TestHandlerWritesConfiguredEncoding(t *testing.T) {
+	dir := outputDir(t)
+	handler := New(Config{TimePrecision: 2, FlushInterval: 60, Encoding: EncodingXML,
+		Out: "file:" + filepath.Join(dir, "out.{{.extension}}")})
+	defer handler.Close()
+
+	handler.Add(time.Now(), map[string]any{"temperature": 22.5}, "environment/")
+	assert.NoError(t, handler.Flush())
+
+	b, err := os.ReadFile(filepath.Join(dir, "out.xml"))
+	assert.NoError(t, err)
+	_, err = senml.Decode(b, senml.XML)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,249 @@
+package senMlWriter
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mainflux/senml"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/itdesign-at/golib/crypt"
+)
+
+var (
+	ErrEnvelope  = errors.New("invalid envelope")
+	ErrSignature = errors.New("envelope signature invalid")
+)
+
+// envelopeVersion is the version of the envelope format
+const envelopeVersion = 1
+
+// envelopeKeyLen is the length of the AES-256 Key in bytes
+const envelopeKeyLen = 32
+
+// EnvelopeConfig wraps the encoded packs written by SenMl2File and
+// SenMl2Syslog in an authenticated envelope. Other outputs ignore it.
+type EnvelopeConfig struct {
+	// Key encrypts the pack with AES-256-GCM, see crypt.SymCrypt.SetKey.
+	// It must have 32 bytes, empty writes the pack unencrypted. Readers
+	// with a Key reject unencrypted envelopes.
+	Key string `json:"key" yaml:"key"`
+
+	// PrivateKeyFile is an Ed25519 private key written by
+	// crypt.GenerateEd25519KeyFiles to sign the envelope.
+	// Empty writes the envelope unsigned.
+	PrivateKeyFile string `json:"privateKeyFile" yaml:"privateKeyFile"`
+
+	// PublicKeyFile is the matching public key (.pub) used by the readers
+	// to verify the signature. When set, unsigned envelopes are rejected.
+	PublicKeyFile string `json:"publicKeyFile" yaml:"publicKeyFile"`
+}
+
+// enabled returns true when packs are written in an envelope.
+func (c EnvelopeConfig) enabled() bool {
+	return c.Key != "" || c.PrivateKeyFile != ""
+}
+
+// Envelope holds an encoded pack, optionally encrypted and signed.
+// It is written as one line of JSON.
+type Envelope struct {
+	// Version of the envelope format
+	Version int `json:"v"`
+
+	// Encoding of the pack in Payload
+	Encoding Encoding `json:"encoding"`
+
+	// Encrypted is true when Payload is encrypted with AES-256-GCM
+	Encrypted bool `json:"encrypted"`
+
+	// Payload is the base64 encoded pack or cipher text
+	Payload string `json:"payload"`
+
+	// Signature is the Ed25519 signature of all other fields, see signed
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// signed returns the data covered by the signature.
+func (e Envelope) signed() []byte {
+	return fmt.Appendf(nil, "senml-envelope/%d\n%s\n%t\n%s", e.Version, e.Encoding, e.Encrypted, e.Payload)
+}
+
+// SealEnvelope encodes the pack and wraps it in an envelope, encrypted
+// with Key and signed with PrivateKeyFile as configured.
+// It returns the envelope as one line of JSON without line break.
+func SealEnvelope(p senml.Pack, enc Encoding, c EnvelopeConfig) ([]byte, error) {
+	b, err := enc.Encode(p)
+	if err != nil {
+		return nil, err
+	}
+	if enc == "" {
+		enc = EncodingJSON
+	}
+
+	e := Envelope{Version: envelopeVersion, Encoding: enc}
+	if c.Key != "" {
+		e.Encrypted = true
+		e.Payload = crypt.NewSymmetricEncryption().SetKey(c.Key).SetPlainText(string(b)).GetCypherBase64()
+		if e.Payload == "" {
+			return nil, fmt.Errorf("%w: encryption failed", ErrEnvelope)
+		}
+	} else {
+		e.Payload = base64.StdEncoding.EncodeToString(b)
+	}
+
+	if c.PrivateKeyFile != "" {
+		key, err := readPrivateKey(c.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		e.Signature = ed25519.Sign(key, e.signed())
+	}
+
+	return json.Marshal(e)
+}
+
+// OpenEnvelope verifies and decrypts an envelope written by SealEnvelope
+// and decodes the pack. With PublicKeyFile the signature must be valid,
+// otherwise ErrSignature is returned. A signed envelope cannot be opened
+// without PublicKeyFile, an encrypted one not without Key. With Key an
+// unencrypted envelope fails with ErrSignature.
+func OpenEnvelope(b []byte, c EnvelopeConfig) (senml.Pack, error) {
+	var e Envelope
+	if err := json.Unmarshal(bytes.TrimSpace(b), &e); err != nil {
+		return senml.Pack{}, fmt.Errorf("%w: %w", ErrEnvelope, err)
+	}
+	if e.Version != envelopeVersion {
+		return senml.Pack{}, fmt.Errorf("%w: unknown version %d", ErrEnvelope, e.Version)
+	}
+
+	switch {
+	case c.PublicKeyFile != "":
+		key, err := readPublicKey(c.PublicKeyFile)
+		if err != nil {
+			return senml.Pack{}, err
+		}
+		if !ed25519.Verify(key, e.signed(), e.Signature) {
+			return senml.Pack{}, ErrSignature
+		}
+	case len(e.Signature) > 0:
+		return senml.Pack{}, fmt.Errorf("%w: signed, but no PublicKeyFile to verify", ErrEnvelope)
+	}
+
+	// a replaced plain envelope must not pass as encrypted data
+	if c.Key != "" && !e.Encrypted {
+		return senml.Pack{}, fmt.Errorf("%w: not encrypted, but a Key is set", ErrSignature)
+	}
+
+	var payload []byte
+	if e.Encrypted {
+		if c.Key == "" {
+			return senml.Pack{}, fmt.Errorf("%w: encrypted, but no Key", ErrEnvelope)
+		}
+		plain, err := crypt.NewSymmetricEncryption().SetKey(c.Key).SetCypherBase64(e.Payload).GetPlainText()
+		if err != nil {
+			// the GCM tag is checked as well, a modified
+			// payload or a wrong key fail here
+			return senml.Pack{}, fmt.Errorf("%w: %w", ErrSignature, err)
+		}
+		payload = []byte(plain)
+	} else {
+		var err error
+		if payload, err = base64.StdEncoding.DecodeString(e.Payload); err != nil {
+			return senml.Pack{}, fmt.Errorf("%w: %w", ErrEnvelope, err)
+		}
+	}
+
+	return Decode(payload, e.Encoding)
+}
+
+// ReadEnvelopeFile reads a file written by SenMl2File with an Envelope,
+// compressed files are decompressed by their extension. The records of
+// all envelopes of an appended file are returned in one pack.
+func ReadEnvelopeFile(fileName string, cfg EnvelopeConfig) (senml.Pack, error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return senml.Pack{}, err
+	}
+	c, _ := compressionOf(fileName)
+	if b, err = c.decompress(b); err != nil {
+		return senml.Pack{}, err
+	}
+
+	var records []senml.Record
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(nil, len(b)+1)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		p, err := OpenEnvelope(scanner.Bytes(), cfg)
+		if err != nil {
+			return senml.Pack{}, err
+		}
+		records = append(records, p.Records...)
+	}
+	return senml.Pack{Records: records}, scanner.Err()
+}
+
+// ParseSyslogEnvelope opens the envelope of a syslog message as written
+// by SenMl2Syslog with an Envelope. The syslog header is skipped.
+func ParseSyslogEnvelope(message []byte, c EnvelopeConfig) (senml.Pack, error) {
+	i := bytes.Index(message, []byte(`{"v":`))
+	if i < 0 {
+		return senml.Pack{}, ErrNoPack
+	}
+	return OpenEnvelope(message[i:], c)
+}
+
+// seal encodes the pack, in an envelope when configured.
+func (w *Writer) seal(p senml.Pack) ([]byte, error) {
+	if !w.cfg.Envelope.enabled() {
+		return w.cfg.Encoding.Encode(p)
+	}
+	return SealEnvelope(p, w.cfg.Encoding, w.cfg.Envelope)
+}
+
+// readPrivateKey reads an OpenSSH Ed25519 private key.
+func readPrivateKey(fileName string) (ed25519.PrivateKey, error) {
+	b, err := os.ReadFile(filepath.Clean(fileName))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := ssh.ParseRawPrivateKey(b)
+	if err != nil {
+		return nil, err
+	}
+	switch key := raw.(type) {
+	case *ed25519.PrivateKey:
+		return *key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s is no Ed25519 private key", fileName)
+}
+
+// readPublicKey reads an Ed25519 public key in the authorized_keys format.
+func readPublicKey(fileName string) (ed25519.PublicKey, error) {
+	b, err := os.ReadFile(filepath.Clean(fileName))
+	if err != nil {
+		return nil, err
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(b)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := pub.(ssh.CryptoPublicKey); ok {
+		if key, ok := c.CryptoPublicKey().(ed25519.PublicKey); ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%s is no Ed25519 public key: %s", fileName, strings.TrimSpace(pub.Type()))
+}
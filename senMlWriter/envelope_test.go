@@ -0,0 +1,181 @@
+package senMlWriter
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/itdesign-at/golib/crypt"
+)
+
+// envelopeKeys generates an Ed25519 key pair and returns an
+// EnvelopeConfig which encrypts, signs and verifies.
+func envelopeKeys(t *testing.T) EnvelopeConfig {
+	dir := t.TempDir()
+	pub, err := crypt.GenerateEd25519KeyFiles(dir, "")
+	assert.NoError(t, err)
+	return EnvelopeConfig{
+		Key:            "0123456789abcdef0123456789abcdef",
+		PrivateKeyFile: filepath.Join(dir, "id_ed25519"),
+		PublicKeyFile:  pub,
+	}
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	keys := envelopeKeys(t)
+
+	configs := map[string]EnvelopeConfig{
+		"encrypted and signed": keys,
+		"signed":               {PrivateKeyFile: keys.PrivateKeyFile, PublicKeyFile: keys.PublicKeyFile},
+		"encrypted":            {Key: keys.Key},
+	}
+	for name, c := range configs {
+		for _, enc := range []Encoding{EncodingJSON, EncodingCBOR} {
+			b, err := SealEnvelope(testPack(), enc, c)
+			assert.NoError(t, err, name)
+			assert.NotContains(t, string(b), "\n", name)
+
+			p, err := OpenEnvelope(b, c)
+			assert.NoError(t, err, name)
+			assert.Equal(t, testPack().Records, p.Records, name)
+		}
+	}
+
+	// the encrypted payload does not reveal the pack
+	b, _ := SealEnvelope(testPack(), EncodingJSON, EnvelopeConfig{Key: keys.Key})
+	assert.NotContains(t, string(b), "environment")
+}
+
+func TestEnvelopeTamperEvidence(t *testing.T) {
+	keys := envelopeKeys(t)
+	b, err := SealEnvelope(testPack(), EncodingJSON, keys)
+	assert.NoError(t, err)
+
+	var e Envelope
+	assert.NoError(t, json.Unmarshal(b, &e))
+
+	var tamper = func(change func(e *Envelope)) []byte {
+		c := e
+		change(&c)
+		b, _ := json.Marshal(c)
+		return b
+	}
+
+	// changed payload, encoding or a removed signature
+	for _, changed := range [][]byte{
+		tamper(func(e *Envelope) {
+			c := byte('x')
+			if e.Payload[8] == c {
+				c = 'y'
+			}
+			e.Payload = e.Payload[:8] + string(c) + e.Payload[9:]
+		}),
+		tamper(func(e *Envelope) { e.Encoding = EncodingCBOR }),
+		tamper(func(e *Envelope) { e.Signature = nil }),
+	} {
+		_, err = OpenEnvelope(changed, keys)
+		assert.ErrorIs(t, err, ErrSignature)
+	}
+
+	// signed with another key
+	other := envelopeKeys(t)
+	_, err = OpenEnvelope(b, EnvelopeConfig{Key: keys.Key, PublicKeyFile: other.PublicKeyFile})
+	assert.ErrorIs(t, err, ErrSignature)
+
+	// wrong AES key, the signature is fine
+	_, err = OpenEnvelope(b, EnvelopeConfig{Key: "wrong", PublicKeyFile: keys.PublicKeyFile})
+	assert.ErrorIs(t, err, ErrSignature)
+
+	// without the keys to verify and decrypt
+	_, err = OpenEnvelope(b, EnvelopeConfig{Key: keys.Key})
+	assert.ErrorIs(t, err, ErrEnvelope)
+	_, err = OpenEnvelope(b, EnvelopeConfig{PublicKeyFile: keys.PublicKeyFile})
+	assert.ErrorIs(t, err, ErrEnvelope)
+
+	// a plain envelope instead of an encrypted one
+	plain, err := SealEnvelope(testPack(), EncodingJSON, EnvelopeConfig{})
+	assert.NoError(t, err)
+	_, err = OpenEnvelope(plain, EnvelopeConfig{Key: keys.Key})
+	assert.ErrorIs(t, err, ErrSignature)
+
+	_, err = OpenEnvelope([]byte(`[{"bn":"x/"}]`), keys)
+	assert.ErrorIs(t, err, ErrEnvelope)
+}
+
+func TestSenMl2FileWithEnvelope(t *testing.T) {
+	keys := envelopeKeys(t)
+	dir := outputDir(t)
+
+	w := NewWriter(WriterConfig{Envelope: keys, File: FileConfig{Append: true, Compression: CompressionGzip}})
+	template := filepath.Join(dir, "{{.baseName}}.{{.extension}}")
+	fileName, err := w.AddPack(testPack()).SenMl2File(template)
+	assert.NoError(t, err)
+	_, err = w.AddPack(testPack()).SenMl2File(template)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(fileName, ".env.gz"), fileName)
+
+	p, err := ReadEnvelopeFile(fileName, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, append(testPack().Records, testPack().Records...), p.Records)
+
+	// one envelope per line, a modified line is detected
+	b, err := os.ReadFile(fileName)
+	assert.NoError(t, err)
+	b, err = CompressionGzip.decompress(b)
+	assert.NoError(t, err)
+	lines := bytes.Split(bytes.TrimSpace(b), []byte("\n"))
+	assert.Len(t, lines, 2)
+
+	plain := filepath.Join(dir, "tampered.env")
+	assert.NoError(t, os.WriteFile(plain, append(append(lines[0], '\n'), bytes.Replace(lines[1], []byte(`"payload":"`), []byte(`"payload":"AAAA`), 1)...), 0o600))
+	_, err = ReadEnvelopeFile(plain, keys)
+	assert.ErrorIs(t, err, ErrSignature)
+}
+
+func TestSyslogWithEnvelope(t *testing.T) {
+	keys := envelopeKeys(t)
+	server := startSyslogServer(t, nil, false)
+
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, Out: "syslog://" + server.address + "/senml02",
+		Envelope: EnvelopeConfig{PrivateKeyFile: keys.PrivateKeyFile}})
+	defer handler.Close()
+
+	handler.Add(time.Now(), map[string]any{"speed": 80.0}, "gps/")
+	assert.NoError(t, handler.Flush())
+
+	line := server.next(t)
+	assert.Contains(t, line, `: {"v":1,`)
+
+	p, err := ParseSyslogEnvelope([]byte(line), EnvelopeConfig{PublicKeyFile: keys.PublicKeyFile})
+	assert.NoError(t, err)
+	assert.Equal(t, "gps/", p.Records[0].BaseName)
+	assert.Equal(t, 80.0, *p.Records[0].Value)
+}
+
+func TestSyslogWithEnvelopeKeepsMaxSize(t *testing.T) {
+	keys := envelopeKeys(t)
+	server := startSyslogServer(t, nil, false)
+
+	const maxSize = 1000
+	w := NewWriter(WriterConfig{Out: "syslog://" + server.address + "/senml02", SyslogMaxSize: maxSize,
+		Envelope: keys})
+	assert.NoError(t, w.AddPack(bigPack(100)).Write())
+
+	records := 0
+	for records < 200 {
+		line := server.next(t)
+		message := line[strings.Index(line, `{"v":`):]
+		assert.LessOrEqual(t, len(message), maxSize)
+
+		p, err := ParseSyslogEnvelope([]byte(line), keys)
+		assert.NoError(t, err)
+		records += len(p.Records)
+	}
+	assert.Equal(t, 200, records)
+}
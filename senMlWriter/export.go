@@ -0,0 +1,213 @@
+package senMlWriter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mainflux/senml"
+)
+
+// csvTimeLayout is the layout of the time column of CSV exports
+const csvTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// Influx converts the pack into InfluxDB line protocol, one line per
+// base name and time. The last part of the base name is the measurement,
+// the whole base name is the tag "baseName" and the names are the fields.
+// The time stamps are in nanoseconds.
+//
+// Example:
+//
+//	gps,baseName=hu/train1/gps latitude=47.6,longitude=17.2 1714557600000000000
+func Influx(p senml.Pack) ([]byte, error) {
+	samples, err := Samples(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	for _, s := range samples {
+		if len(s.Data) == 0 {
+			continue
+		}
+
+		bn := strings.TrimSuffix(s.BaseName, "/")
+		measurement := bn[strings.LastIndex(bn, "/")+1:]
+		if measurement == "" {
+			measurement = "senml"
+		}
+
+		b.WriteString(influxEscape(measurement, ", "))
+		if bn != "" {
+			b.WriteString(",baseName=" + influxEscape(bn, ",= "))
+		}
+
+		var names []string
+		for name := range s.Data {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		for i, name := range names {
+			if i == 0 {
+				b.WriteByte(' ')
+			} else {
+				b.WriteByte(',')
+			}
+			b.WriteString(influxEscape(name, ",= ") + "=" + influxValue(s.Data[name]))
+		}
+		fmt.Fprintf(&b, " %d\n", s.Time.UnixNano())
+	}
+	return b.Bytes(), nil
+}
+
+// CSV converts the pack into CSV with one row per base name and time.
+// The columns are time, baseName and the names in alphabetical order,
+// missing values are empty.
+func CSV(p senml.Pack) ([]byte, error) {
+	samples, err := Samples(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, s := range samples {
+		for name := range s.Data {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	slices.Sort(names)
+
+	rows := [][]string{append([]string{"time", "baseName"}, names...)}
+	for _, s := range samples {
+		row := []string{s.Time.Format(csvTimeLayout), s.BaseName}
+		for _, name := range names {
+			v, ok := s.Data[name]
+			if !ok {
+				row = append(row, "")
+				continue
+			}
+			row = append(row, csvValue(v))
+		}
+		rows = append(rows, row)
+	}
+
+	var b bytes.Buffer
+	err = csv.NewWriter(&b).WriteAll(rows)
+	return b.Bytes(), err
+}
+
+// SenMl2Influx writes the senml.Pack as InfluxDB line protocol to a file,
+// see Influx and SenMl2File for the file name template. {{.extension}} is "lp".
+// With File.Append the lines are added to an existing file.
+func (w *Writer) SenMl2Influx(fileNameTemplate string) (string, error) {
+	return w.writeFile(fileNameTemplate, "lp", func(old []byte) ([]byte, error) {
+		b, err := Influx(w.p)
+		if err != nil {
+			return nil, err
+		}
+		return append(old, b...), nil
+	})
+}
+
+// SenMl2Csv writes the senml.Pack as CSV to a file, see CSV and SenMl2File
+// for the file name template. {{.extension}} is "csv".
+// With File.Append the rows are added to an existing file, new names
+// are added as columns.
+func (w *Writer) SenMl2Csv(fileNameTemplate string) (string, error) {
+	return w.writeFile(fileNameTemplate, "csv", func(old []byte) ([]byte, error) {
+		b, err := CSV(w.p)
+		if err != nil || old == nil {
+			return b, err
+		}
+		return mergeCSV(old, b)
+	})
+}
+
+// mergeCSV returns the rows of a followed by the rows of b. The columns
+// of b missing in a are appended to the header.
+func mergeCSV(a, b []byte) ([]byte, error) {
+	rowsA, err := csv.NewReader(bytes.NewReader(a)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	rowsB, err := csv.NewReader(bytes.NewReader(b)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rowsA) == 0 {
+		return b, nil
+	}
+	if len(rowsB) == 0 {
+		return a, nil
+	}
+
+	header := slices.Clone(rowsA[0])
+	for _, name := range rowsB[0] {
+		if !slices.Contains(header, name) {
+			header = append(header, name)
+		}
+	}
+
+	rows := [][]string{header}
+	var remap = func(columns []string, data [][]string) {
+		for _, d := range data {
+			row := make([]string, len(header))
+			for i, v := range d {
+				row[slices.Index(header, columns[i])] = v
+			}
+			rows = append(rows, row)
+		}
+	}
+	remap(rowsA[0], rowsA[1:])
+	remap(rowsB[0], rowsB[1:])
+
+	var buf bytes.Buffer
+	err = csv.NewWriter(&buf).WriteAll(rows)
+	return buf.Bytes(), err
+}
+
+// influxEscape escapes the given characters with a backslash.
+func influxEscape(s, chars string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(chars, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// influxValue formats a field value: floats, booleans and strings.
+// Data values are written as base64 strings.
+func influxValue(v any) string {
+	switch val := v.(type) {
+	case bool:
+		return strconv.FormatBool(val)
+	case string:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(val) + `"`
+	case []byte:
+		return `"` + base64.RawURLEncoding.EncodeToString(val) + `"`
+	}
+	return strconv.FormatFloat(toFloat64(v), 'f', -1, 64)
+}
+
+// csvValue formats a CSV value, data values are base64 encoded.
+func csvValue(v any) string {
+	switch val := v.(type) {
+	case bool:
+		return strconv.FormatBool(val)
+	case string:
+		return val
+	case []byte:
+		return base64.RawURLEncoding.EncodeToString(val)
+	}
+	return strconv.FormatFloat(toFloat64(v), 'f', -1, 64)
+}
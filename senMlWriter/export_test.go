@@ -0,0 +1,76 @@
+package senMlWriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mainflux/senml"
+	"github.com/stretchr/testify/assert"
+)
+
+// exportPack returns a pack with typed values, escaping and a missing value.
+func exportPack() senml.Pack {
+	handler := New(Config{TimePrecision: 3, FlushInterval: 3600})
+	_ = handler.Close()
+
+	t0 := time.UnixMilli(1714557600000)
+	handler.Add(t0, map[string]any{"speed": 80.5, "door": `open "left"`, "moving": true}, "hu/train1/gps/")
+	handler.Add(t0.Add(1500*time.Millisecond), map[string]any{"speed": 81}, "hu/train1/gps/")
+	return handler.packs["hu/train1/gps/"]
+}
+
+func TestInflux(t *testing.T) {
+	b, err := Influx(exportPack())
+	assert.NoError(t, err)
+	assert.Equal(t, `gps,baseName=hu/train1/gps door="open \"left\"",moving=true,speed=80.5 1714557600000000000
+gps,baseName=hu/train1/gps speed=81 1714557601500000000
+`, string(b))
+}
+
+func TestCSV(t *testing.T) {
+	b, err := CSV(exportPack())
+	assert.NoError(t, err)
+
+	t0 := time.UnixMilli(1714557600000)
+	assert.Equal(t, "time,baseName,door,moving,speed\n"+
+		t0.Format(csvTimeLayout)+`,hu/train1/gps/,"open ""left""",true,80.5`+"\n"+
+		t0.Add(1500*time.Millisecond).Format(csvTimeLayout)+",hu/train1/gps/,,,81\n", string(b))
+}
+
+func TestMergeCSV(t *testing.T) {
+	b, err := mergeCSV([]byte("time,speed\nt1,1\n"), []byte("time,latitude,speed\nt2,47.6,2\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "time,speed,latitude\nt1,1,\nt2,2,47.6\n", string(b))
+}
+
+func TestInfluxAndCsvFileOutputs(t *testing.T) {
+	dir := outputDir(t)
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, File: FileConfig{Append: true},
+		Out:  "influx:" + filepath.Join(dir, "{{.baseName}}.{{.extension}}"),
+		Outs: []string{"csv:" + filepath.Join(dir, "{{.baseName}}.{{.extension}}")}})
+	defer handler.Close()
+
+	t0 := time.UnixMilli(1714557600000)
+	handler.Add(t0, map[string]any{"speed": 1}, "gps/")
+	assert.NoError(t, handler.Flush())
+	handler.Add(t0.Add(time.Second), map[string]any{"speed": 2, "latitude": 47.6}, "gps/")
+	assert.NoError(t, handler.Flush())
+
+	b, err := os.ReadFile(filepath.Join(dir, "gps.lp"))
+	assert.NoError(t, err)
+	assert.Equal(t, "gps,baseName=gps speed=1 1714557600000000000\n"+
+		"gps,baseName=gps latitude=47.6,speed=2 1714557601000000000\n", string(b))
+
+	b, err = os.ReadFile(filepath.Join(dir, "gps.csv"))
+	assert.NoError(t, err)
+	assert.Equal(t, "time,baseName,speed,latitude\n"+
+		t0.Format(csvTimeLayout)+",gps/,1,\n"+
+		t0.Add(time.Second).Format(csvTimeLayout)+",gps/,2,47.6\n", string(b))
+}
+
+func TestInfluxEscape(t *testing.T) {
+	assert.Equal(t, `a\,b\=c\ d`, influxEscape("a,b=c d", ",= "))
+	assert.Equal(t, `"a \"b\" \\"`, influxValue(`a "b" \`))
+}
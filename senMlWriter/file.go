@@ -3,8 +3,10 @@ package senMlWriter
 import (
 	"bytes"
 	"log"
+	"log/slog"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"text/template"
 	"time"
@@ -12,52 +14,179 @@ import (
 	"github.com/mainflux/senml"
 )
 
+// FileConfig holds the options for "file:", "influx:" and "csv:" outputs.
+type FileConfig struct {
+	// Append adds the records to an existing file, e.g. when a second
+	// flush writes to the same time-bucketed file name. Without Append
+	// the file is replaced.
+	Append bool `json:"append" yaml:"append"`
+
+	// Compression is none (default), gzip or zstd. The extension .gz
+	// or .zst is appended to the file name.
+	Compression Compression `json:"compression" yaml:"compression"`
+
+	// RetentionDir is the directory cleaned up after every write,
+	// including its sub directories. Only files with the extension of
+	// the written file (plus .gz or .zst) are removed. MaxAge and
+	// MaxBytes need a RetentionDir.
+	RetentionDir string `json:"retentionDir" yaml:"retentionDir"`
+
+	// MaxAge in seconds removes older files, 0 means unlimited.
+	MaxAge int `json:"maxAge" yaml:"maxAge"`
+
+	// MaxBytes removes the oldest files until the total size of the
+	// files in the retention directory is below, 0 means unlimited.
+	MaxBytes int64 `json:"maxBytes" yaml:"maxBytes"`
+}
+
 // SenMl2File writes the senml.Pack to a file with the given name template.
 // The template can contain any golang time fields that ar replaced during
-// runtime.
+// runtime, {{.baseName}} and {{.extension}} (json, cbor, xml or jsonl
+// depending on the Encoding).
+// The file is compressed, appended and cleaned up as configured in File.
+// With an Envelope the file holds one envelope per line, {{.extension}}
+// is "env", see ReadEnvelopeFile.
 // It returns the name of the file written to and nil on success.
 func (w *Writer) SenMl2File(fileNameTemplate string) (string, error) {
+	if w.cfg.Envelope.enabled() {
+		return w.writeFile(fileNameTemplate, "env", func(old []byte) ([]byte, error) {
+			b, err := w.seal(w.p)
+			if err != nil {
+				return nil, err
+			}
+			return append(append(old, b...), '\n'), nil
+		})
+	}
+	return w.writeFile(fileNameTemplate, w.cfg.Encoding.Extension(), func(old []byte) ([]byte, error) {
+		p := w.p
+		if old != nil {
+			// the base fields of the first record of the writer are
+			// kept, so the records stay valid SenML
+			o, err := Decode(old, w.cfg.Encoding)
+			if err != nil {
+				return nil, err
+			}
+			p = senml.Pack{Records: append(o.Records, w.p.Records...)}
+		}
+		return w.cfg.Encoding.Encode(p)
+	})
+}
+
+// writeFile writes a file with the given name template. The content function
+// returns the file content, with File.Append it gets the decompressed content
+// of an existing file. A file which cannot be appended is renamed to
+// <name>.broken.
+func (w *Writer) writeFile(fileNameTemplate, extension string, content func(old []byte) ([]byte, error)) (string, error) {
 
 	// Write to tmp file first to avoid partial writes.
 	// Other processes should not read the file while it is being written.
 
 	bt := time.Now()
-	bn := ""
 	// replace now with the first record time
 	if len(w.p.Records) > 0 {
 		bt = time.UnixMilli(int64(w.p.Records[0].BaseTime) * 1000)
-		bn = w.p.Records[0].BaseName
 	}
 
-	fileName := bt.Format(fileNameTemplate) + ".tmp"
-
-	t := template.New("x")
-	_, err := t.Parse(fileName)
+	fileName, err := expandTemplate(bt.Format(fileNameTemplate), map[string]any{
+		"baseName":  w.baseName(),
+		"extension": extension,
+	})
 	if err != nil {
 		log.Println(err)
 		return "", err
 	}
+	cfg := w.cfg.File
+	fileName += cfg.Compression.Extension()
 
-	var tmp bytes.Buffer
-	if err := t.Execute(&tmp, map[string]any{"baseName": strings.TrimSuffix(bn, "/")}); err == nil {
-		fileName = tmp.String()
+	var old []byte
+	if cfg.Append {
+		old, err = os.ReadFile(fileName)
+		switch {
+		case os.IsNotExist(err):
+			old, err = nil, nil
+		case err != nil:
+			return "", err
+		default:
+			var b []byte
+			if b, err = cfg.Compression.decompress(old); err == nil {
+				old = b
+			}
+		}
 	}
 
-	b, err := senml.Encode(w.p, senml.JSON)
+	var b []byte
+	if err == nil {
+		b, err = content(old)
+	}
+	if err != nil && old != nil {
+		slog.Warn("senMlWriter file not appendable, renamed", "file", fileName, "error", err.Error())
+		if err = os.Rename(fileName, fileName+".broken"); err != nil {
+			return "", err
+		}
+		b, err = content(nil)
+	}
 	if err != nil {
 		return "", err
 	}
 
+	if b, err = cfg.Compression.compress(b); err != nil {
+		return "", err
+	}
+
 	err = os.MkdirAll(path.Dir(fileName), os.ModePerm)
 	if err != nil {
 		return "", err
 	}
 
-	err = os.WriteFile(fileName, b, 0640)
+	err = os.WriteFile(fileName+".tmp", b, 0640)
 	if err != nil {
 		return "", err
 	}
 
-	finalName := fileName[:len(fileName)-4] // remove .tmp suffix from final file name
-	return finalName, os.Rename(fileName, finalName)
+	if err = os.Rename(fileName+".tmp", fileName); err != nil {
+		return "", err
+	}
+	w.written += len(b)
+
+	_, name := compressionOf(fileName)
+	err = enforceRetention(cfg.RetentionDir, filepath.Ext(name), time.Duration(cfg.MaxAge)*time.Second, cfg.MaxBytes)
+	if err != nil {
+		slog.Warn("senMlWriter file retention failed", "dir", cfg.RetentionDir, "error", err.Error())
+	}
+
+	return fileName, nil
+}
+
+// baseName returns the base name of the first record without trailing slash.
+func (w *Writer) baseName() string {
+	if len(w.p.Records) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(w.p.Records[0].BaseName, "/")
+}
+
+// expandBaseName replaces {{.baseName}} in the given text with the base name
+// of the first record. A trailing slash of the base name is removed.
+// {{.extension}} is replaced with the file extension of the encoding.
+// The text is returned unchanged when the template cannot be executed.
+func (w *Writer) expandBaseName(text string) (string, error) {
+	return expandTemplate(text, map[string]any{
+		"baseName":  w.baseName(),
+		"extension": w.cfg.Encoding.Extension(),
+	})
+}
+
+// expandTemplate replaces the template fields in the given text with data.
+func expandTemplate(text string, data map[string]any) (string, error) {
+	t := template.New("x")
+	_, err := t.Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var tmp bytes.Buffer
+	if err := t.Execute(&tmp, data); err != nil {
+		return text, nil
+	}
+	return tmp.String(), nil
 }
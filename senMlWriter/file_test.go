@@ -0,0 +1,133 @@
+package senMlWriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSenMl2FileAppends(t *testing.T) {
+	dir := outputDir(t)
+
+	for _, c := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+		for _, enc := range []Encoding{EncodingJSON, EncodingCBOR, EncodingXML, EncodingJSONLines} {
+			handler := New(Config{TimePrecision: 2, FlushInterval: 3600, Encoding: enc,
+				Out:  "file:" + filepath.Join(dir, string(c)+"{{.baseName}}.{{.extension}}"),
+				File: FileConfig{Append: true, Compression: c}})
+
+			t0 := time.UnixMilli(1714557600000)
+			handler.Add(t0, map[string]any{"speed": 1.0}, "gps/")
+			assert.NoError(t, handler.Flush())
+			handler.Add(t0.Add(time.Second), map[string]any{"speed": 2.0}, "gps/")
+			assert.NoError(t, handler.Flush())
+			_ = handler.Close()
+
+			fileName := filepath.Join(dir, string(c)+"gps."+enc.Extension()+c.Extension())
+			p, err := ReadFile(fileName)
+			assert.NoError(t, err, fileName)
+			samples, err := Samples(p)
+			assert.NoError(t, err, fileName)
+			assert.Equal(t, 2, len(samples), fileName)
+			if len(samples) == 2 {
+				assert.True(t, t0.Equal(samples[0].Time), fileName)
+				assert.True(t, t0.Add(time.Second).Equal(samples[1].Time), fileName)
+				assert.Equal(t, 2.0, samples[1].Data.Float64("speed"), fileName)
+			}
+		}
+	}
+}
+
+func TestSenMl2FileReplacesWithoutAppend(t *testing.T) {
+	dir := outputDir(t)
+	w := NewWriter(WriterConfig{File: FileConfig{Compression: CompressionGzip}})
+
+	template := filepath.Join(dir, "{{.baseName}}.json")
+	_, err := w.AddPack(testPack()).SenMl2File(template)
+	assert.NoError(t, err)
+	fileName, err := w.AddPack(testPack()).SenMl2File(template)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "environment.json.gz"), fileName)
+
+	p, err := ReadFile(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, testPack(), p)
+}
+
+func TestSenMl2FileRenamesBrokenFile(t *testing.T) {
+	dir := outputDir(t)
+	fileName := filepath.Join(dir, "environment.json")
+	assert.NoError(t, os.WriteFile(fileName, []byte("[{broken"), 0640))
+
+	w := NewWriter(WriterConfig{File: FileConfig{Append: true}})
+	_, err := w.AddPack(testPack()).SenMl2File(filepath.Join(dir, "{{.baseName}}.json"))
+	assert.NoError(t, err)
+	assert.FileExists(t, fileName+".broken")
+
+	p, err := ReadFile(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, testPack(), p)
+}
+
+func TestEnforceRetention(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name string, size int, age time.Duration) {
+		fileName := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fileName), os.ModePerm))
+		assert.NoError(t, os.WriteFile(fileName, make([]byte, size), 0640))
+		mod := time.Now().Add(-age)
+		assert.NoError(t, os.Chtimes(fileName, mod, mod))
+	}
+
+	write("2024/05/01/gps.json", 100, 72*time.Hour)
+	write("2024/05/02/gps.json", 100, 48*time.Hour)
+	write("2024/05/03/gps.json", 100, 24*time.Hour)
+	write("2024/05/04/gps.json", 100, time.Hour)
+	write("2024/05/04/gps.json.tmp", 100, 96*time.Hour)
+	write("2024/04/30/gps.json.gz", 100, 96*time.Hour)
+	write("notes/important.txt", 100, 96*time.Hour)
+	write("2024/05/02/gps.csv", 100, 96*time.Hour)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "empty"), os.ModePerm))
+
+	assert.NoError(t, enforceRetention(dir, ".json", 60*time.Hour, 150))
+
+	assert.NoDirExists(t, filepath.Join(dir, "2024/05/01"))
+	assert.NoDirExists(t, filepath.Join(dir, "2024/04"))
+	assert.NoFileExists(t, filepath.Join(dir, "2024/05/02/gps.json"))
+	assert.NoFileExists(t, filepath.Join(dir, "2024/05/03/gps.json"))
+	assert.FileExists(t, filepath.Join(dir, "2024/05/04/gps.json"))
+	assert.FileExists(t, filepath.Join(dir, "2024/05/04/gps.json.tmp"))
+
+	// files of other outputs or programs and their directories are kept
+	assert.FileExists(t, filepath.Join(dir, "notes/important.txt"))
+	assert.FileExists(t, filepath.Join(dir, "2024/05/02/gps.csv"))
+	assert.DirExists(t, filepath.Join(dir, "empty"))
+}
+
+func TestSenMl2FileRetentionKeepsForeignFiles(t *testing.T) {
+	dir := outputDir(t)
+	important := filepath.Join(dir, "notes", "important.txt")
+	old := filepath.Join(dir, "old.json")
+	for _, name := range []string{important, old} {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(name), os.ModePerm))
+		assert.NoError(t, os.WriteFile(name, []byte("[]"), 0640))
+		mod := time.Now().Add(-48 * time.Hour)
+		assert.NoError(t, os.Chtimes(name, mod, mod))
+	}
+
+	// without RetentionDir nothing is removed
+	_, err := NewWriter(WriterConfig{File: FileConfig{MaxAge: 3600}}).AddPack(testPack()).
+		SenMl2File(filepath.Join(dir, "x.json"))
+	assert.NoError(t, err)
+	assert.FileExists(t, old)
+
+	_, err = NewWriter(WriterConfig{File: FileConfig{RetentionDir: dir, MaxAge: 3600}}).AddPack(testPack()).
+		SenMl2File(filepath.Join(dir, "x.json"))
+	assert.NoError(t, err)
+	assert.NoFileExists(t, old)
+	assert.FileExists(t, important)
+	assert.FileExists(t, filepath.Join(dir, "x.json"))
+}
@@ -0,0 +1,128 @@
+package senMlWriter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+var ErrHTTPStatus = errors.New("unexpected http status")
+
+// HTTPConfig holds the options for "http://" and "https://" outputs.
+type HTTPConfig struct {
+	// Headers are added to every request, e.g. an API key.
+	Headers map[string]string `json:"headers" yaml:"headers"`
+
+	// BearerToken is sent as "Authorization: Bearer <token>".
+	BearerToken string `json:"bearerToken" yaml:"bearerToken"`
+
+	// Timeout in seconds for one request, default is 10.
+	Timeout int `json:"timeout" yaml:"timeout"`
+
+	// Retries is the number of retries after a failed request, 0 means
+	// no retry. Network errors, 429 and 5xx responses are retried.
+	// A Handler does not retry within a flush, the pack is kept and
+	// written again with the next flush.
+	Retries int `json:"retries" yaml:"retries"`
+
+	// RetryDelay is the delay in milliseconds before the first retry,
+	// default is 500. The delay doubles with every retry.
+	RetryDelay int `json:"retryDelay" yaml:"retryDelay"`
+}
+
+// SenMl2Http posts the senml.Pack to a SenML ingest endpoint.
+// The url should be in the form of "https://iot.example.com/api/senml/{{.baseName}}",
+// {{.baseName}} is replaced with the base name of the pack. User and password
+// in the url are sent as basic authentication.
+// The content type matches the Encoding, e.g. application/senml+json.
+// It returns an error when the endpoint does not answer with a 2xx status,
+// failed requests are retried with exponential backoff as configured in HTTP.
+// The writers of a Handler send one request only.
+func (w *Writer) SenMl2Http(url string) error {
+	url, err := w.expandBaseName(url)
+	if err != nil {
+		return err
+	}
+
+	b, err := w.encode()
+	if err != nil {
+		return err
+	}
+
+	cfg := w.cfg.HTTP
+	if w.cfg.handler {
+		cfg.Retries = 0
+	}
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	delay := time.Duration(cfg.RetryDelay) * time.Millisecond
+	if delay == 0 {
+		delay = 500 * time.Millisecond
+	}
+
+	client := &http.Client{Timeout: timeout}
+	if w.cfg.TLS != (TLSConfig{}) {
+		tlsConfig, err := w.cfg.TLS.tlsConfig()
+		if err != nil {
+			return err
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		client.Transport = transport
+		defer transport.CloseIdleConnections()
+	}
+
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = w.post(client, url, b)
+		if err == nil || !retry || attempt >= cfg.Retries {
+			return w.count(len(b), err)
+		}
+
+		if w.cfg.debug {
+			slog.Debug("senMlWriter SenMl2Http retry", "attempt", attempt+1,
+				"delay", delay.String(), "error", err.Error())
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// post sends one request. It returns true when the request
+// should be retried.
+func (w *Writer) post(client *http.Client, url string, b []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", w.cfg.Encoding.ContentType())
+	for key, value := range w.cfg.HTTP.Headers {
+		req.Header.Set(key, value)
+	}
+	if w.cfg.HTTP.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+w.cfg.HTTP.BearerToken)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if w.cfg.debug {
+		slog.Debug("senMlWriter SenMl2Http", "url", req.URL.Redacted(), "status", resp.Status, "bytes", len(b))
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("%w: %s", ErrHTTPStatus, resp.Status)
+}
@@ -0,0 +1,129 @@
+package senMlWriter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSenMl2HttpPostsPack(t *testing.T) {
+	type request struct {
+		path, contentType, authorization, apiKey string
+		body                                     []byte
+	}
+	requests := make(chan request, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{
+			path:          r.URL.Path,
+			contentType:   r.Header.Get("Content-Type"),
+			authorization: r.Header.Get("Authorization"),
+			apiKey:        r.Header.Get("X-Api-Key"),
+			body:          body,
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	for _, enc := range []Encoding{EncodingJSON, EncodingCBOR} {
+		w := NewWriter(WriterConfig{
+			Out:      server.URL + "/senml/{{.baseName}}",
+			Encoding: enc,
+			HTTP:     HTTPConfig{BearerToken: "secret", Headers: map[string]string{"X-Api-Key": "key"}},
+		})
+		assert.NoError(t, w.AddPack(testPack()).Write(), enc)
+
+		r := <-requests
+		assert.Equal(t, "/senml/environment", r.path, enc)
+		assert.Equal(t, enc.ContentType(), r.contentType, enc)
+		assert.Equal(t, "Bearer secret", r.authorization, enc)
+		assert.Equal(t, "key", r.apiKey, enc)
+
+		p, err := Decode(r.body, enc)
+		assert.NoError(t, err, enc)
+		assert.Equal(t, testPack(), p, enc)
+	}
+}
+
+func TestSenMl2HttpRetries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	w := NewWriter(WriterConfig{Out: server.URL, HTTP: HTTPConfig{Retries: 3, RetryDelay: 10}})
+	assert.NoError(t, w.AddPack(testPack()).Write())
+	assert.Equal(t, int32(3), calls.Load())
+
+	// retries exhausted
+	calls.Store(0)
+	w = NewWriter(WriterConfig{Out: server.URL, HTTP: HTTPConfig{Retries: 1, RetryDelay: 10}})
+	assert.ErrorIs(t, w.AddPack(testPack()).Write(), ErrHTTPStatus)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestHandlerDoesNotWaitForHttpRetries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, Out: server.URL,
+		HTTP: HTTPConfig{Retries: 3, RetryDelay: 2000}})
+	defer handler.Close()
+	handler.Add(time.Now(), map[string]any{"speed": 80.0}, "gps/")
+
+	// one request without waiting for the RetryDelay
+	start := time.Now()
+	assert.ErrorIs(t, handler.Flush(), ErrHTTPStatus)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(1), calls.Load())
+
+	// the pack is written with the next flush
+	assert.NoError(t, handler.Flush())
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, 0, handler.Stats().BufferedPacks)
+}
+
+func TestSenMl2HttpNoRetryOnClientError(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	w := NewWriter(WriterConfig{Out: server.URL, HTTP: HTTPConfig{Retries: 3, RetryDelay: 10}})
+	assert.ErrorIs(t, w.AddPack(testPack()).Write(), ErrHTTPStatus)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestSenMl2HttpTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	// the test server certificate is not trusted
+	w := NewWriter(WriterConfig{Out: server.URL})
+	assert.Error(t, w.AddPack(testPack()).Write())
+
+	w = NewWriter(WriterConfig{Out: server.URL, TLS: TLSConfig{InsecureSkipVerify: true}})
+	assert.NoError(t, w.AddPack(testPack()).Write())
+}
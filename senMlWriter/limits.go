@@ -0,0 +1,134 @@
+package senMlWriter
+
+import (
+	"encoding/json"
+	"log/slog"
+	"slices"
+
+	"github.com/mainflux/senml"
+)
+
+// OverflowPolicy defines what Add does when a pack reached
+// MaxRecordsPerPack or MaxBytesPerPack because the Out is down.
+type OverflowPolicy string
+
+const (
+	// OverflowKeep keeps adding records, the pack grows unbounded (default)
+	OverflowKeep OverflowPolicy = "keep"
+
+	// OverflowDropNewest drops the added data while the pack is full
+	OverflowDropNewest OverflowPolicy = "dropNewest"
+
+	// OverflowDropOldest drops the oldest samples of the pack
+	OverflowDropOldest OverflowPolicy = "dropOldest"
+
+	// OverflowBlock blocks Add until the pack was written (back-pressure)
+	OverflowBlock OverflowPolicy = "block"
+)
+
+// full returns true when the pack of the base name reached
+// MaxRecordsPerPack or MaxBytesPerPack.
+func (h *Handler) full(bn string) bool {
+	if h.config.MaxRecordsPerPack > 0 && len(h.packs[bn].Records) >= h.config.MaxRecordsPerPack {
+		return true
+	}
+	return h.config.MaxBytesPerPack > 0 && h.sizes[bn] >= h.config.MaxBytesPerPack
+}
+
+// makeRoom applies the overflow policy before the records of one sample
+// are added to a full pack. It returns false when the data must be dropped,
+// records are counted as dropped then. Without block
+// OverflowBlock keeps adding, e.g. while the scheduler itself flushes.
+func (h *Handler) makeRoom(bn string, records int, block bool) bool {
+	if !h.full(bn) {
+		return true
+	}
+
+	switch h.config.OverflowPolicy {
+	case OverflowDropNewest:
+		h.dropped += records
+		if h.debug {
+			slog.Debug("senMlWriter pack full, drops newest data", "baseName", bn)
+		}
+		return false
+	case OverflowDropOldest:
+		for h.full(bn) && len(h.packs[bn].Records) > 0 {
+			h.dropOldest(bn)
+		}
+	case OverflowBlock:
+		for block && h.full(bn) && !h.closed {
+			h.requestFlush(bn)
+			h.flushed.Wait()
+		}
+	}
+	return true
+}
+
+// dropOldest removes all records of the oldest sample from the pack.
+// The next record takes over base name and base time, its time stays
+// relative to the unchanged base time.
+func (h *Handler) dropOldest(bn string) {
+	pack := h.packs[bn]
+	first := pack.Records[0]
+
+	n := 1
+	for n < len(pack.Records) && pack.Records[n].Time == first.Time {
+		n++
+	}
+	h.dropped += n
+
+	if n == len(pack.Records) {
+		h.removePack(bn)
+		return
+	}
+
+	records := slices.Clone(pack.Records[n:])
+	records[0].BaseName = first.BaseName
+	records[0].BaseTime = first.BaseTime
+	pack.Records = records
+	h.packs[bn] = pack
+	h.sizes[bn] = packSize(pack.Records)
+	h.shiftAccepted(bn, n)
+	h.updateBuffered(0)
+
+	if h.debug {
+		slog.Debug("senMlWriter pack full, drops oldest sample", "baseName", bn, "records", n)
+	}
+}
+
+// requestFlush asks the scheduler to write the pack of the base name
+// as soon as possible. It never blocks. After a failed flush the pack
+// waits for the next interval, so an Out which is down is not dialed
+// with every Add.
+func (h *Handler) requestFlush(bn string) {
+	if h.retryLater[bn] {
+		return
+	}
+	select {
+	case h.flushRequests <- bn:
+	default:
+		// the request queue is full, the pack is flushed later
+	}
+}
+
+// removePack removes the pack of the base name and wakes up blocked Add calls.
+func (h *Handler) removePack(bn string) {
+	delete(h.packs, bn)
+	delete(h.sizes, bn)
+	delete(h.accepted, bn)
+	delete(h.flushedAt, bn)
+	delete(h.retryLater, bn)
+	h.updateBuffered(0)
+	h.flushed.Broadcast()
+}
+
+// packSize returns the approximate size in bytes of the records
+// encoded as SenML JSON.
+func packSize(records []senml.Record) int {
+	size := 0
+	for _, r := range records {
+		b, _ := json.Marshal(r)
+		size += len(b) + 1
+	}
+	return size
+}
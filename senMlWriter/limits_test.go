@@ -0,0 +1,166 @@
+package senMlWriter
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxRecordsPerPackTriggersFlush(t *testing.T) {
+	dir := outputDir(t)
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, MaxRecordsPerPack: 4,
+		Out: "file:" + filepath.Join(dir, "{{.baseName}}.json")})
+	defer handler.Close()
+
+	t0 := time.Now()
+	handler.Add(t0, map[string]any{"latitude": 47.601987, "longitude": 17.249188}, "gps/")
+	handler.Add(t0.Add(time.Second), map[string]any{"latitude": 47.601985, "longitude": 17.249185}, "gps/")
+
+	assert.Eventually(t, func() bool {
+		handler.Lock()
+		defer handler.Unlock()
+		return len(handler.packs) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	p, err := ReadFile(filepath.Join(dir, "gps.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(p.Records))
+}
+
+func TestMaxBytesPerPackTriggersFlush(t *testing.T) {
+	dir := outputDir(t)
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, MaxBytesPerPack: 100,
+		Out: "file:" + filepath.Join(dir, "{{.baseName}}.json")})
+	defer handler.Close()
+
+	handler.Add(time.Now(), map[string]any{"latitude": 47.601987}, "gps/")
+	handler.Lock()
+	assert.Contains(t, handler.packs, "gps/")
+	handler.Unlock()
+
+	handler.Add(time.Now(), map[string]any{"latitude": 47.601987, "longitude": 17.249188}, "gps/")
+
+	assert.Eventually(t, func() bool {
+		handler.Lock()
+		defer handler.Unlock()
+		return len(handler.packs) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.FileExists(t, filepath.Join(dir, "gps.json"))
+}
+
+func TestOverflowDropNewest(t *testing.T) {
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, MaxRecordsPerPack: 2,
+		OverflowPolicy: OverflowDropNewest, Out: unreachableOut})
+	defer handler.Close()
+
+	t0 := time.Now()
+	for i := 0; i < 5; i++ {
+		handler.Add(t0.Add(time.Duration(i)*time.Second), map[string]any{"speed": float64(i)}, "gps/")
+	}
+	// every record of the sample is dropped
+	handler.Add(t0.Add(5*time.Second), map[string]any{"latitude": 47.6, "longitude": 17.2}, "gps/")
+
+	handler.Lock()
+	defer handler.Unlock()
+	records := handler.packs["gps/"].Records
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, 0.0, *records[0].Value)
+	assert.Equal(t, 1.0, *records[1].Value)
+	assert.Equal(t, 5, handler.dropped)
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, MaxRecordsPerPack: 4,
+		OverflowPolicy: OverflowDropOldest, Out: unreachableOut})
+	defer handler.Close()
+
+	t0 := time.UnixMilli(1714557600000)
+	for i := 0; i < 5; i++ {
+		handler.Add(t0.Add(time.Duration(i)*time.Second), map[string]any{"latitude": float64(i), "longitude": float64(i)}, "gps/")
+	}
+
+	handler.Lock()
+	pack := handler.packs["gps/"]
+	dropped := handler.dropped
+	handler.Unlock()
+
+	assert.Equal(t, 6, dropped)
+	assert.Equal(t, 4, len(pack.Records))
+	assert.Equal(t, "gps/", pack.Records[0].BaseName)
+
+	samples, err := Samples(pack)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(samples))
+	assert.True(t, t0.Add(3*time.Second).Equal(samples[0].Time))
+	assert.Equal(t, 3.0, samples[0].Data.Float64("latitude"))
+	assert.True(t, t0.Add(4*time.Second).Equal(samples[1].Time))
+	assert.Equal(t, 4.0, samples[1].Data.Float64("latitude"))
+}
+
+func TestOverflowBlockWaitsForFlush(t *testing.T) {
+	dir := outputDir(t)
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, MaxRecordsPerPack: 1,
+		OverflowPolicy: OverflowBlock, Out: unreachableOut})
+	defer handler.Close()
+
+	handler.Add(time.Now(), map[string]any{"speed": 1.0}, "gps/")
+
+	added := make(chan struct{})
+	go func() {
+		handler.Add(time.Now(), map[string]any{"speed": 2.0}, "gps/")
+		close(added)
+	}()
+
+	select {
+	case <-added:
+		t.Fatal("Add must block while the pack is full")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// the Out is reachable again
+	handler.Lock()
+	handler.config.Out = "file:" + filepath.Join(dir, "{{.baseName}}.json")
+	handler.Unlock()
+	assert.NoError(t, handler.Flush())
+
+	select {
+	case <-added:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Add still blocked after flush")
+	}
+}
+
+func TestFullPackWaitsForIntervalWhileOutIsDown(t *testing.T) {
+	sink := Memory("TestFullPackWaitsForInterval")
+	defer sink.Reset()
+	sink.Fail(errors.New("output down"))
+
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, MaxRecordsPerPack: 2,
+		Out: "memory:TestFullPackWaitsForInterval"})
+	defer handler.Close()
+
+	t0 := time.Now()
+	for i := 0; i < 50; i++ {
+		handler.Add(t0.Add(time.Duration(i)*time.Second), map[string]any{"speed": float64(i)}, "gps/")
+	}
+
+	// one early flush fails, the following Add calls do not write again
+	assert.Eventually(t, func() bool {
+		return handler.Stats().FlushErrors > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, int64(1), handler.Stats().FlushErrors)
+	assert.Equal(t, 50, handler.Stats().BufferedRecords)
+
+	// after a successful flush full packs are written early again
+	sink.Fail(nil)
+	assert.NoError(t, handler.Flush())
+	handler.Add(t0.Add(time.Minute), map[string]any{"speed": 1.0}, "gps/")
+	handler.Add(t0.Add(time.Minute+time.Second), map[string]any{"speed": 2.0}, "gps/")
+	assert.Eventually(t, func() bool {
+		return len(sink.Packs()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,79 @@
+package senMlWriter
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mainflux/senml"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/stretchr/testify/assert"
+)
+
+// startMqttBroker starts an in-process MQTT broker on a random port.
+// All messages published below "#" are sent to the returned channel.
+func startMqttBroker(t *testing.T) (string, chan packets.Packet) {
+	server := mochi.New(&mochi.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	assert.NoError(t, server.AddHook(new(auth.AllowHook), nil))
+
+	tcp := listeners.NewTCP(listeners.Config{ID: "t1", Address: "127.0.0.1:0"})
+	assert.NoError(t, server.AddListener(tcp))
+	assert.NoError(t, server.Serve())
+	t.Cleanup(func() { _ = server.Close() })
+
+	messages := make(chan packets.Packet, 10)
+	assert.NoError(t, server.Subscribe("#", 1, func(cl *mochi.Client, sub packets.Subscription, pk packets.Packet) {
+		messages <- pk
+	}))
+
+	return tcp.Address(), messages
+}
+
+func TestSenMl2MqttPublishesPack(t *testing.T) {
+	address, messages := startMqttBroker(t)
+
+	v := 22.5
+	pack := senml.Pack{Records: []senml.Record{{BaseName: "hu/train1/gps/", Name: "speed", Value: &v}}}
+
+	w := NewWriter(WriterConfig{
+		Out:  "mqtt://" + address + "/senml/{{.baseName}}",
+		MQTT: MQTTConfig{QoS: 1, Retain: true, ClientID: "senMlWriterTest"},
+	})
+	assert.NoError(t, w.AddPack(pack).Write())
+
+	select {
+	case pk := <-messages:
+		assert.Equal(t, "senml/hu/train1/gps", pk.TopicName)
+		assert.True(t, pk.FixedHeader.Retain)
+		p, err := senml.Decode(pk.Payload, senml.JSON)
+		assert.NoError(t, err)
+		assert.Equal(t, pack.Records, p.Records)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+}
+
+func TestSenMl2MqttWithoutTopicFails(t *testing.T) {
+	w := NewWriter(WriterConfig{Out: "mqtt://127.0.0.1:1883"})
+	assert.ErrorIs(t, w.Write(), ErrNoTopic)
+}
+
+func TestSenMl2MqttUnreachableBrokerFails(t *testing.T) {
+	w := NewWriter(WriterConfig{Out: "mqtt://127.0.0.1:1/senml", MQTT: MQTTConfig{Timeout: 1}})
+	assert.Error(t, w.Write())
+}
+
+func TestMqttClientIDIsUniquePerConnection(t *testing.T) {
+	a, b := MQTTConfig{}.clientID(), MQTTConfig{}.clientID()
+	assert.True(t, strings.HasPrefix(a, "senMlWriter-"), a)
+	assert.NotEqual(t, a, b)
+	assert.Equal(t, "train1", MQTTConfig{ClientID: "train1"}.clientID())
+}
@@ -0,0 +1,89 @@
+package senMlWriter
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/itdesign-at/golib/converter"
+)
+
+var ErrNoSubject = errors.New("subject is missing")
+
+// NATSConfig holds the options for "nats://" outputs.
+type NATSConfig struct {
+	// JetStream publishes to a JetStream stream and waits for the
+	// acknowledgement of the server (at-least-once delivery).
+	// A stream covering the subject must exist on the server.
+	JetStream bool `json:"jetStream" yaml:"jetStream"`
+
+	// Timeout in seconds for connecting and publishing, default is 10.
+	Timeout int `json:"timeout" yaml:"timeout"`
+}
+
+// SenMl2Nats publishes the senml.Pack to a NATS server.
+// The server string should be in the form of "nats://host:4222/senml.{{.baseName}}".
+// {{.baseName}} in the subject is replaced with the base name of the pack
+// normalized by converter.Normalize, because "/" and "." are not usable in
+// subject tokens.
+// Without JetStream the message is flushed to the server, with JetStream
+// SenMl2Nats waits for the publish acknowledgement of the stream.
+func (w *Writer) SenMl2Nats(server string) error {
+	scheme, rest, _ := strings.Cut(server, "://")
+	host, subjectTemplate, _ := strings.Cut(rest, "/")
+
+	subject, err := expandTemplate(subjectTemplate, map[string]any{
+		"baseName":  converter.Normalize(w.baseName()),
+		"extension": w.cfg.Encoding.Extension(),
+	})
+	if err != nil {
+		return err
+	}
+	if subject == "" {
+		return ErrNoSubject
+	}
+
+	timeout := time.Duration(w.cfg.NATS.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	b, err := w.encode()
+	if err != nil {
+		return err
+	}
+
+	nc, err := nats.Connect(scheme+"://"+host, nats.Timeout(timeout), nats.Name("senMlWriter"))
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	if w.cfg.debug {
+		slog.Debug("senMlWriter SenMl2Nats", "server", host, "subject", subject,
+			"jetStream", w.cfg.NATS.JetStream, "bytes", len(b))
+	}
+
+	if !w.cfg.NATS.JetStream {
+		if err = nc.Publish(subject, b); err != nil {
+			return err
+		}
+		return w.count(len(b), nc.FlushTimeout(timeout))
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	_, err = js.Publish(ctx, subject, b)
+	return w.count(len(b), err)
+}
@@ -0,0 +1,89 @@
+package senMlWriter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mainflux/senml"
+	"github.com/nats-io/nats-server/v2/server"
+	natsTest "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+)
+
+// startNatsServer starts an in-process NATS server with JetStream
+// enabled on a random port and returns its client URL.
+func startNatsServer(t *testing.T) string {
+	opts := natsTest.DefaultTestOptions
+	opts.Port = server.RANDOM_PORT
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+
+	s := natsTest.RunServer(&opts)
+	t.Cleanup(s.Shutdown)
+	return s.ClientURL()
+}
+
+func TestSenMl2NatsPublishesPack(t *testing.T) {
+	url := startNatsServer(t)
+
+	nc, err := nats.Connect(url)
+	assert.NoError(t, err)
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("senml.>")
+	assert.NoError(t, err)
+	assert.NoError(t, nc.Flush())
+
+	v := 22.5
+	pack := senml.Pack{Records: []senml.Record{{BaseName: "hu/train1/gps/", Name: "speed", Value: &v}}}
+
+	w := NewWriter(WriterConfig{Out: url + "/senml.{{.baseName}}"})
+	assert.NoError(t, w.AddPack(pack).Write())
+
+	msg, err := sub.NextMsg(5 * time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "senml.huQ2Ftrain1Q2Fgps", msg.Subject)
+
+	p, err := senml.Decode(msg.Data, senml.JSON)
+	assert.NoError(t, err)
+	assert.Equal(t, pack.Records, p.Records)
+}
+
+func TestSenMl2NatsJetStreamWaitsForAck(t *testing.T) {
+	url := startNatsServer(t)
+
+	nc, err := nats.Connect(url)
+	assert.NoError(t, err)
+	defer nc.Close()
+
+	js, err := jetstream.New(nc)
+	assert.NoError(t, err)
+	stream, err := js.CreateStream(context.Background(), jetstream.StreamConfig{Name: "SENML", Subjects: []string{"senml.>"}})
+	assert.NoError(t, err)
+
+	handler := New(Config{TimePrecision: 2, FlushInterval: 60, Out: url + "/senml.{{.baseName}}", NATS: NATSConfig{JetStream: true}})
+	defer handler.Close()
+
+	handler.Add(time.Now(), map[string]any{"temperature": 22.5}, "environment/")
+	assert.NoError(t, handler.Flush())
+	assert.Empty(t, handler.packs)
+
+	info, err := stream.Info(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), info.State.Msgs)
+}
+
+func TestSenMl2NatsJetStreamWithoutStreamKeepsPack(t *testing.T) {
+	url := startNatsServer(t)
+
+	handler := New(Config{TimePrecision: 2, FlushInterval: 60, Out: url + "/senml.{{.baseName}}",
+		NATS: NATSConfig{JetStream: true, Timeout: 1}})
+	defer handler.Close()
+
+	handler.Add(time.Now(), map[string]any{"temperature": 22.5}, "environment/")
+	assert.Error(t, handler.Flush())
+	assert.Contains(t, handler.packs, "environment/")
+}
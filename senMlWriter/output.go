@@ -0,0 +1,262 @@
+package senMlWriter
+
+import (
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mainflux/senml"
+)
+
+// Output is a sink for packs. Outputs are registered per URL scheme
+// with RegisterOutput and used for every Out starting with "<scheme>:".
+// The built-in outputs are registered the same way.
+// A Handler keeps the output open between flushes and opens a new one
+// after a failed write, a standalone Writer opens and closes the output
+// for every Write.
+type Output interface {
+	// Open prepares the output for the given Out, e.g. connects.
+	Open(out string, cfg WriterConfig) error
+
+	// Write writes the pack.
+	Write(p senml.Pack) error
+
+	// Close releases the resources of the output.
+	Close() error
+}
+
+// OutputFactory creates a new Output.
+type OutputFactory func() Output
+
+var registry = struct {
+	sync.RWMutex
+	m map[string]OutputFactory
+}{m: make(map[string]OutputFactory)}
+
+// RegisterOutput registers the factory for the URL scheme, e.g. "kafka"
+// for the Out "kafka://broker:9092/topic". A registered scheme is replaced,
+// built-in schemes like "file" too. A nil factory removes the scheme.
+func RegisterOutput(scheme string, factory OutputFactory) error {
+	registry.Lock()
+	defer registry.Unlock()
+	if factory == nil {
+		delete(registry.m, scheme)
+		return nil
+	}
+	registry.m[scheme] = factory
+	return nil
+}
+
+// LookupOutput returns the factory registered for the URL scheme, e.g.
+// to wrap a built-in output:
+//
+//	file, _ := LookupOutput("file")
+//	_ = RegisterOutput("file", func() Output { return &auditOutput{Output: file()} })
+func LookupOutput(scheme string) (OutputFactory, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	factory, ok := registry.m[scheme]
+	return factory, ok
+}
+
+// writeOutput writes the pack with the output registered for the scheme.
+func (w *Writer) writeOutput(scheme string) error {
+	factory, ok := LookupOutput(scheme)
+	if !ok {
+		return ErrUnknownOut
+	}
+
+	var open = func() (io.Closer, error) {
+		o := factory()
+		if err := o.Open(w.cfg.Out, w.cfg); err != nil {
+			_ = o.Close()
+			return nil, err
+		}
+		return o, nil
+	}
+
+	if w.cfg.conns == nil {
+		o, err := open()
+		if err != nil {
+			return err
+		}
+		err = w.writeTo(o.(Output))
+		return errors.Join(err, o.Close())
+	}
+
+	key := "output+" + w.cfg.Out
+	o, err := w.cfg.conns.get(key, open)
+	if err != nil {
+		return err
+	}
+	if err = w.writeTo(o.(Output)); err != nil {
+		// the next write opens a new output
+		_ = w.cfg.conns.drop(key)
+	}
+	return err
+}
+
+// writeTo writes the pack to the output. Outputs get the pack and not
+// its bytes, the size of the pack in the configured Encoding is counted
+// as written.
+func (w *Writer) writeTo(o Output) error {
+	if b, ok := o.(*writerOutput); ok {
+		// built-in outputs count the bytes they write
+		return b.write(w)
+	}
+	if err := o.Write(w.p); err != nil {
+		return err
+	}
+	b, _ := w.encode()
+	return w.count(len(b), nil)
+}
+
+func init() {
+	var (
+		toFile = func(w *Writer) error {
+			_, err := w.SenMl2File(outPath(w.cfg.Out))
+			return err
+		}
+		toInflux = func(w *Writer) error {
+			_, err := w.SenMl2Influx(outPath(w.cfg.Out))
+			return err
+		}
+		toCsv = func(w *Writer) error {
+			_, err := w.SenMl2Csv(outPath(w.cfg.Out))
+			return err
+		}
+		toSyslog = func(w *Writer) error { return w.SenMl2Syslog(w.cfg.Out) }
+		toMqtt   = func(w *Writer) error { return w.SenMl2Mqtt(w.cfg.Out) }
+		toNats   = func(w *Writer) error { return w.SenMl2Nats(w.cfg.Out) }
+		toHttp   = func(w *Writer) error { return w.SenMl2Http(w.cfg.Out) }
+	)
+
+	for scheme, write := range map[string]func(w *Writer) error{
+		"file": toFile, "influx": toInflux, "csv": toCsv,
+		"syslog": toSyslog, "syslog+tcp": toSyslog, "syslog+udp": toSyslog, "syslog+tls": toSyslog,
+		"mqtt": toMqtt, "mqtts": toMqtt, "nats": toNats, "http": toHttp, "https": toHttp,
+	} {
+		_ = RegisterOutput(scheme, builtinOutput(write))
+	}
+	_ = RegisterOutput("stdout", StreamOutput(os.Stdout))
+	_ = RegisterOutput("stderr", StreamOutput(os.Stderr))
+	_ = RegisterOutput("memory", func() Output { return &memoryOutput{} })
+}
+
+// outPath returns the Out without its scheme, e.g. the file name of "file:".
+func outPath(out string) string {
+	_, path, _ := strings.Cut(out, ":")
+	return path
+}
+
+// writerOutput is the Output of a built-in scheme, it writes with
+// a method of the Writer.
+type writerOutput struct {
+	write func(w *Writer) error
+	cfg   WriterConfig
+}
+
+// builtinOutput returns the factory of a built-in output.
+func builtinOutput(write func(w *Writer) error) OutputFactory {
+	return func() Output { return &writerOutput{write: write} }
+}
+
+func (o *writerOutput) Open(out string, cfg WriterConfig) error {
+	o.cfg = cfg
+	o.cfg.Out = out
+	return nil
+}
+
+func (o *writerOutput) Write(p senml.Pack) error {
+	return o.write(&Writer{cfg: o.cfg, p: p})
+}
+
+func (o *writerOutput) Close() error {
+	return nil
+}
+
+// MemorySink keeps the packs written to the Out "memory:<name>" in memory,
+// e.g. for unit tests. See Memory.
+type MemorySink struct {
+	sync.Mutex
+	packs []senml.Pack
+	err   error
+}
+
+var memorySinks = struct {
+	sync.Mutex
+	m map[string]*MemorySink
+}{m: make(map[string]*MemorySink)}
+
+// Memory returns the sink of the Out "memory:<name>".
+//
+// Example:
+//
+//	handler := New(Config{Out: "memory:test"})
+//	...
+//	packs := Memory("test").Packs()
+func Memory(name string) *MemorySink {
+	memorySinks.Lock()
+	defer memorySinks.Unlock()
+
+	s, ok := memorySinks.m[name]
+	if !ok {
+		s = &MemorySink{}
+		memorySinks.m[name] = s
+	}
+	return s
+}
+
+// Packs returns the packs written to the sink.
+func (s *MemorySink) Packs() []senml.Pack {
+	s.Lock()
+	defer s.Unlock()
+	return slices.Clone(s.packs)
+}
+
+// Reset removes all packs and the error of the sink.
+func (s *MemorySink) Reset() {
+	s.Lock()
+	defer s.Unlock()
+	s.packs = nil
+	s.err = nil
+}
+
+// Fail lets all writes fail with err, nil accepts writes again.
+// Use it to simulate an output which is down.
+func (s *MemorySink) Fail(err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.err = err
+}
+
+func (s *MemorySink) write(p senml.Pack) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.packs = append(s.packs, senml.Pack{Records: slices.Clone(p.Records)})
+	return nil
+}
+
+// memoryOutput is the Output of the scheme "memory".
+type memoryOutput struct {
+	sink *MemorySink
+}
+
+func (m *memoryOutput) Open(out string, _ WriterConfig) error {
+	m.sink = Memory(strings.TrimPrefix(out, "memory:"))
+	return nil
+}
+
+func (m *memoryOutput) Write(p senml.Pack) error {
+	return m.sink.write(p)
+}
+
+func (m *memoryOutput) Close() error {
+	return nil
+}
@@ -0,0 +1,119 @@
+package senMlWriter
+
+import (
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mainflux/senml"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingOutput counts the calls of the Output methods.
+type countingOutput struct {
+	opened, written, closed *atomic.Int32
+	err                     error
+}
+
+func (c countingOutput) Open(out string, cfg WriterConfig) error {
+	c.opened.Add(1)
+	return nil
+}
+
+func (c countingOutput) Write(p senml.Pack) error {
+	c.written.Add(1)
+	return c.err
+}
+
+func (c countingOutput) Close() error {
+	c.closed.Add(1)
+	return nil
+}
+
+func TestRegisterOutput(t *testing.T) {
+	c := countingOutput{opened: &atomic.Int32{}, written: &atomic.Int32{}, closed: &atomic.Int32{}}
+	assert.NoError(t, RegisterOutput("counting", func() Output { return c }))
+	defer RegisterOutput("counting", nil)
+
+	// a writer opens and closes the output for every write
+	w := NewWriter(WriterConfig{Out: "counting://somewhere"})
+	assert.NoError(t, w.AddPack(testPack()).Write())
+	assert.NoError(t, w.AddPack(testPack()).Write())
+	assert.Equal(t, int32(2), c.opened.Load())
+	assert.Equal(t, int32(2), c.written.Load())
+	assert.Equal(t, int32(2), c.closed.Load())
+
+	// a handler keeps the output open
+	c.opened.Store(0)
+	c.closed.Store(0)
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, Out: "counting://somewhere"})
+	for i := 0; i < 3; i++ {
+		handler.Add(time.Now(), map[string]any{"speed": i}, "train/")
+		assert.NoError(t, handler.Flush())
+	}
+	assert.NoError(t, handler.Close())
+	assert.Equal(t, int32(1), c.opened.Load())
+	assert.Equal(t, int32(1), c.closed.Load())
+
+	assert.ErrorIs(t, NewWriter(WriterConfig{Out: "unregistered://x"}).AddPack(testPack()).Write(), ErrUnknownOut)
+}
+
+// wrappedOutput counts the packs written by the wrapped Output.
+type wrappedOutput struct {
+	Output
+	written *atomic.Int32
+}
+
+func (o wrappedOutput) Write(p senml.Pack) error {
+	o.written.Add(1)
+	return o.Output.Write(p)
+}
+
+func TestWrapBuiltinOutput(t *testing.T) {
+	file, ok := LookupOutput("file")
+	assert.True(t, ok)
+	written := &atomic.Int32{}
+	assert.NoError(t, RegisterOutput("file", func() Output { return wrappedOutput{Output: file(), written: written} }))
+	defer RegisterOutput("file", file)
+
+	dir := outputDir(t)
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, Out: "file:" + filepath.Join(dir, "{{.baseName}}.json")})
+	handler.Add(time.Now(), map[string]any{"speed": 80}, "train/")
+	assert.NoError(t, handler.Flush())
+	assert.NoError(t, handler.Close())
+
+	assert.Equal(t, int32(1), written.Load())
+	assert.FileExists(t, filepath.Join(dir, "train.json"))
+
+	// a removed scheme is unknown
+	assert.NoError(t, RegisterOutput("file", nil))
+	assert.ErrorIs(t, NewWriter(WriterConfig{Out: "file:" + filepath.Join(dir, "x.json")}).AddPack(testPack()).Write(), ErrUnknownOut)
+}
+
+func TestMemorySink(t *testing.T) {
+	sink := Memory("TestMemorySink")
+	defer sink.Reset()
+
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, Out: "memory:TestMemorySink"})
+	defer handler.Close()
+
+	t0 := time.Now()
+	sink.Fail(errors.New("down"))
+	handler.Add(t0, map[string]any{"speed": 80}, "train/")
+	assert.EqualError(t, handler.Flush(), "down")
+	assert.Empty(t, sink.Packs())
+
+	sink.Fail(nil)
+	handler.Add(t0.Add(time.Second), map[string]any{"speed": 90}, "train/")
+	assert.NoError(t, handler.Flush())
+
+	assert.Greater(t, handler.Stats().Outputs["memory:TestMemorySink"].Bytes, int64(0))
+
+	packs := sink.Packs()
+	assert.Equal(t, 1, len(packs))
+	samples, err := Samples(packs[0])
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(samples))
+}
@@ -0,0 +1,141 @@
+package senMlWriter
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"path/filepath"
+	"slices"
+
+	"github.com/mainflux/senml"
+)
+
+// outputs returns Out followed by Outs. Without any output the empty
+// Out is returned, so writing fails with ErrUnknownOut.
+func (h *Handler) outputs() []string {
+	return h.config.outputs()
+}
+
+// outputs returns Out followed by the Outs without duplicates.
+func (c Config) outputs() []string {
+	var outs []string
+	if c.Out != "" {
+		outs = append(outs, c.Out)
+	}
+	for _, out := range c.Outs {
+		if out != "" && !slices.Contains(outs, out) {
+			outs = append(outs, out)
+		}
+	}
+	if len(outs) == 0 {
+		outs = append(outs, "")
+	}
+	return outs
+}
+
+// quorum returns the number of outputs which must accept a pack
+// before it is removed.
+func (c Config) quorum(outputs int) int {
+	if c.Quorum > 0 && c.Quorum < outputs {
+		return c.Quorum
+	}
+	return outputs
+}
+
+// spoolFor returns the spool of the output or nil when no SpoolDir
+// is configured. The first output of the Config uses SpoolDir, every
+// further output a sub directory of its own.
+func (h *Handler) spoolFor(out string) *spool {
+	if h.spool == nil || out == h.outputs()[0] {
+		return h.spool
+	}
+	if s, ok := h.spools[out]; ok {
+		return s
+	}
+
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(out))
+
+	c := h.config
+	c.SpoolDir = filepath.Join(c.SpoolDir, fmt.Sprintf("out-%08x", hash.Sum32()))
+	s := newSpool(c, h.debug)
+	h.spools[out] = s
+	return s
+}
+
+// flushTo writes the records of the pack which the output has not
+// accepted yet. It returns true when the output accepted all records,
+// records moved to the spool count as accepted.
+func (h *Handler) flushTo(out, bn string, p senml.Pack) (bool, error) {
+	p = h.unaccepted(bn, out, p)
+	if len(p.Records) == 0 {
+		return true, nil
+	}
+	if h.config.SortRecords {
+		p = sortPack(p, h.configFor(bn).TimePrecision)
+	}
+
+	s := h.spoolFor(out)
+
+	// as long as older packs are waiting in the spool,
+	// new packs are queued behind them
+	if s != nil && !s.empty() {
+		if err := s.store(p); err == nil {
+			h.accept(bn, out)
+			return true, nil
+		}
+	}
+
+	err := h.write(out, p)
+	if err == nil {
+		h.accept(bn, out)
+		return true, nil
+	}
+
+	if s != nil {
+		if serr := s.store(p); serr != nil {
+			slog.Error("senMlWriter spool store failed", "out", out, "error", serr.Error())
+			return false, err
+		}
+		h.accept(bn, out)
+		return true, err
+	}
+	return false, err
+}
+
+// unaccepted returns the records of the pack the output has not accepted
+// yet. The first record carries the base fields in effect.
+func (h *Handler) unaccepted(bn, out string, p senml.Pack) senml.Pack {
+	n := h.accepted[bn][out]
+	if n == 0 {
+		return p
+	}
+	if n >= len(p.Records) {
+		return senml.Pack{}
+	}
+
+	var base senml.Record
+	for _, r := range p.Records[:n+1] {
+		inheritBase(&base, r)
+	}
+	records := slices.Clone(p.Records[n:])
+	records[0] = withBase(records[0], base)
+	return senml.Pack{Records: records}
+}
+
+// accept marks all records of the pack as accepted by the output,
+// so they are not written again while other outputs still fail.
+func (h *Handler) accept(bn, out string) {
+	if h.accepted[bn] == nil {
+		h.accepted[bn] = make(map[string]int)
+	}
+	h.accepted[bn][out] = len(h.packs[bn].Records)
+}
+
+// shiftAccepted corrects the accepted records of all outputs after
+// n records were removed from the front of the pack.
+func (h *Handler) shiftAccepted(bn string, n int) {
+	for out, accepted := range h.accepted[bn] {
+		h.accepted[bn][out] = max(0, accepted-n)
+	}
+}
@@ -0,0 +1,100 @@
+package senMlWriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlushWritesAllOutputs(t *testing.T) {
+	dir := outputDir(t)
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600,
+		Out:  "file:" + filepath.Join(dir, "archive", "{{.baseName}}.json"),
+		Outs: []string{"file:" + filepath.Join(dir, "forward", "{{.baseName}}.json")}})
+	defer handler.Close()
+
+	handler.Add(time.Now(), map[string]any{"speed": 1.0}, "gps/")
+	assert.NoError(t, handler.Flush())
+	assert.Empty(t, handler.packs)
+
+	for _, sub := range []string{"archive", "forward"} {
+		p, err := ReadFile(filepath.Join(dir, sub, "gps.json"))
+		assert.NoError(t, err, sub)
+		assert.Equal(t, 1, len(p.Records), sub)
+	}
+}
+
+func TestFlushRetriesFailedOutputOnly(t *testing.T) {
+	dir := outputDir(t)
+
+	// a file blocks the directory of the second output
+	blocker := filepath.Join(dir, "forward")
+	assert.NoError(t, os.WriteFile(blocker, nil, 0640))
+
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600,
+		Out:  "file:" + filepath.Join(dir, "archive", "{{.baseName}}.json"),
+		Outs: []string{"file:" + filepath.Join(blocker, "{{.baseName}}.json")}})
+	defer handler.Close()
+
+	t0 := time.UnixMilli(1714557600000)
+	handler.Add(t0, map[string]any{"speed": 1.0}, "gps/")
+	assert.Error(t, handler.Flush())
+	assert.Contains(t, handler.packs, "gps/")
+
+	handler.Add(t0.Add(time.Second), map[string]any{"speed": 2.0}, "gps/")
+	assert.NoError(t, os.Remove(blocker))
+	assert.NoError(t, handler.Flush())
+	assert.Empty(t, handler.packs)
+	assert.Empty(t, handler.accepted)
+
+	// the archive got the second sample only
+	p, err := ReadFile(filepath.Join(dir, "archive", "gps.json"))
+	assert.NoError(t, err)
+	samples, err := Samples(p)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(samples))
+	assert.True(t, t0.Add(time.Second).Equal(samples[0].Time))
+	assert.Equal(t, "gps/", samples[0].BaseName)
+
+	// the recovered output got both samples
+	p, err = ReadFile(filepath.Join(dir, "forward", "gps.json"))
+	assert.NoError(t, err)
+	samples, err = Samples(p)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(samples))
+}
+
+func TestFlushQuorumRemovesPack(t *testing.T) {
+	dir := outputDir(t)
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, Quorum: 1,
+		Out:  "file:" + filepath.Join(dir, "{{.baseName}}.json"),
+		Outs: []string{unreachableOut}})
+	defer handler.Close()
+
+	handler.Add(time.Now(), map[string]any{"speed": 1.0}, "gps/")
+	assert.Error(t, handler.Flush())
+	assert.Empty(t, handler.packs)
+	assert.FileExists(t, filepath.Join(dir, "gps.json"))
+}
+
+func TestFlushSpoolsPerOutput(t *testing.T) {
+	dir := outputDir(t)
+	spoolDir := t.TempDir()
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, SpoolDir: spoolDir,
+		Out:  "file:" + filepath.Join(dir, "{{.baseName}}.json"),
+		Outs: []string{unreachableOut}})
+	defer handler.Close()
+
+	handler.Add(time.Now(), map[string]any{"speed": 1.0}, "gps/")
+	assert.Error(t, handler.Flush())
+	assert.Empty(t, handler.packs)
+
+	// only the failed output has spooled the pack
+	assert.True(t, handler.spool.empty())
+	files, err := handler.spoolFor(unreachableOut).files()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(files))
+}
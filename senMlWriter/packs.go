@@ -1,6 +1,7 @@
 package senMlWriter
 
 import (
+	"context"
 	"log/slog"
 	"log/syslog"
 	"math"
@@ -21,14 +22,119 @@ type Config struct {
 	// field(s) for sending data
 	Out string `json:"out" yaml:"out"`
 
+	// Outs are further outputs, every pack is written to Out and all Outs.
+	// Each output keeps its own retry state, so an output which is down
+	// gets the records it missed without duplicates for the others.
+	Outs []string `json:"outs" yaml:"outs"`
+
+	// Quorum is the number of outputs which must accept a pack before
+	// it is removed, 0 means all outputs. Outputs which are still down
+	// then miss the pack unless a SpoolDir is configured.
+	Quorum int `json:"quorum" yaml:"quorum"`
+
 	SyslogPriority syslog.Priority `json:"syslogPriority" yaml:"syslogPriority"`
 
+	// SyslogMaxSize is the maximum size in bytes of one syslog message,
+	// header, framing and an Envelope included. Larger packs are split into
+	// several packs, each carrying base name and base time. 0 means unlimited.
+	SyslogMaxSize int `json:"syslogMaxSize" yaml:"syslogMaxSize"`
+
+	// SyslogFormat is legacy (default, format of log/syslog) or rfc5424.
+	// Use "syslog+udp://" or "syslog+tls://" in Out for UDP and TLS,
+	// the certificates for TLS are configured in TLS.
+	SyslogFormat SyslogFormat `json:"syslogFormat" yaml:"syslogFormat"`
+
+	// Encoding is the format of the written packs: json (default), cbor,
+	// xml or jsonl (one record per line). Use {{.extension}} in a file
+	// name template to get the matching file extension.
+	Encoding Encoding `json:"encoding" yaml:"encoding"`
+
+	// File holds the options for "file:" outputs: append,
+	// compression and retention.
+	File FileConfig `json:"file" yaml:"file"`
+
+	// MQTT holds the options for "mqtt://" and "mqtts://" outputs.
+	MQTT MQTTConfig `json:"mqtt" yaml:"mqtt"`
+
+	// NATS holds the options for "nats://" outputs.
+	// With JetStream enabled a pack is only removed after the
+	// server acknowledged it.
+	NATS NATSConfig `json:"nats" yaml:"nats"`
+
+	// HTTP holds the options for "http://" and "https://" outputs.
+	HTTP HTTPConfig `json:"http" yaml:"http"`
+
+	// TLS holds the certificates for encrypted outputs.
+	TLS TLSConfig `json:"tls" yaml:"tls"`
+
+	// Envelope encrypts and signs the packs written by "file:" and
+	// syslog outputs, see EnvelopeConfig.
+	Envelope EnvelopeConfig `json:"envelope" yaml:"envelope"`
+
 	// TimePrecision is the number of digits after the decimal point.
 	// The precision is used to round the time to reduce digits.
 	TimePrecision int `json:"timePrecision" yaml:"timePrecision"`
 
 	// FlushInterval is the interval in seconds to write the data to the Out.
 	FlushInterval int `json:"flushInterval" yaml:"flushInterval"`
+
+	// SpoolDir is an optional directory where packs are stored when writing
+	// to the Out fails. Spooled packs survive a restart and are replayed in
+	// order as soon as the Out is reachable again.
+	SpoolDir string `json:"spoolDir" yaml:"spoolDir"`
+
+	// SpoolMaxBytes limits the total size of the spool directory in bytes.
+	// The oldest packs are dropped first, 0 means unlimited.
+	SpoolMaxBytes int64 `json:"spoolMaxBytes" yaml:"spoolMaxBytes"`
+
+	// SpoolMaxAge is the maximum age in seconds of a spooled pack.
+	// Older packs are dropped, 0 means unlimited.
+	SpoolMaxAge int `json:"spoolMaxAge" yaml:"spoolMaxAge"`
+
+	// MaxRecordsPerPack triggers an immediate flush of a base name when
+	// its pack reached the number of records, 0 means unlimited.
+	// After a failed flush the base name waits for the FlushInterval.
+	MaxRecordsPerPack int `json:"maxRecordsPerPack" yaml:"maxRecordsPerPack"`
+
+	// MaxBytesPerPack triggers an immediate flush of a base name when
+	// its pack reached the size in bytes (SenML JSON), 0 means unlimited.
+	MaxBytesPerPack int `json:"maxBytesPerPack" yaml:"maxBytesPerPack"`
+
+	// SortRecords sorts the records of a pack by time before it is
+	// written. The earliest record becomes the base time, so samples
+	// added out of order never produce negative times.
+	SortRecords bool `json:"sortRecords" yaml:"sortRecords"`
+
+	// Watermark in seconds: a sample older than the newest sample of its
+	// base name minus Watermark is late and handled by LatePolicy.
+	// 0 accepts all samples.
+	Watermark int `json:"watermark" yaml:"watermark"`
+
+	// LatePolicy is reject (default) or clamp, which sets the time of
+	// a late sample to the watermark.
+	LatePolicy LatePolicy `json:"latePolicy" yaml:"latePolicy"`
+
+	// ClockJump in seconds: a sample this much newer or older than the
+	// newest sample of its base name is taken as clock jump, e.g. NTP
+	// after boot. The jump is logged and counted in Stats, the watermark
+	// restarts at the new time. 0 disables the detection.
+	ClockJump int `json:"clockJump" yaml:"clockJump"`
+
+	// Routes override the outputs, TimePrecision, FlushInterval and
+	// syslog tag for base names with a prefix, see Route.
+	Routes []Route `json:"routes" yaml:"routes"`
+
+	// Aggregation holds aggregation windows per base name. The samples
+	// of a window are reduced to min/max/avg/last/count/sum records.
+	Aggregation map[string]Aggregation `json:"aggregation" yaml:"aggregation"`
+
+	// Deadband holds change-only filters per key. A value is only added
+	// when it changed more than the thresholds since the last added value.
+	Deadband map[string]Deadband `json:"deadband" yaml:"deadband"`
+
+	// OverflowPolicy defines what Add does when a pack is still full
+	// because the Out is down: keep (default), dropNewest, dropOldest or block.
+	OverflowPolicy OverflowPolicy `json:"overflowPolicy" yaml:"overflowPolicy"`
 }
 
 // Handler is a Sensorml handler.
@@ -43,6 +149,64 @@ type Handler struct {
 	stop          chan struct{}
 	done          chan struct{}
 
+	// spool is nil when no SpoolDir is configured
+	spool *spool
+
+	// spools holds the spools of the outputs after the first one
+	spools map[string]*spool
+
+	// accepted holds the number of records per base name and output
+	// which were already written to the output
+	accepted map[string]map[string]int
+
+	// conns holds persistent output connections, e.g. syslog
+	conns *connections
+
+	// sizes holds the approximate size in bytes of each pack
+	sizes map[string]int
+
+	// flushedAt holds the time of the last flush per base name,
+	// see due
+	flushedAt map[string]time.Time
+
+	// newest holds the time of the newest sample per base name
+	// for Watermark and ClockJump
+	newest map[string]time.Time
+
+	// windows holds the running aggregation windows per base name
+	windows map[string]*window
+
+	// emitted holds the last added value per base name and key
+	// for the deadband filter
+	emitted map[string]map[string]emitted
+
+	// flushRequests holds base names which reached a pack limit
+	flushRequests chan string
+
+	// retryLater holds the base names whose last flush failed,
+	// they are not flushed early until a flush succeeded
+	retryLater map[string]bool
+
+	// flushed wakes up Add calls blocked by OverflowBlock
+	flushed *sync.Cond
+	closed  bool
+
+	// ctx closes the handler when it is done
+	ctx      context.Context
+	stopOnce sync.Once
+
+	// closeErr is the error of the final flush, set before done is closed
+	closeErr error
+
+	// errs receives the flush errors, see Errors
+	errs chan error
+
+	// dropped counts the records dropped by the overflow policy
+	dropped int
+
+	// stats holds the counters returned by Stats
+	stats *handlerStats
+
 	debug bool
 }
 
@@ -50,6 +214,13 @@ type Handler struct {
 // The handler is used to add data to the Sensorml handler.
 // The handler writes the data to the configured Out every minute.
 func New(c Config) *Handler {
+	return NewWithContext(context.Background(), c)
+}
+
+// NewWithContext creates a new Sensorml handler like New. When the
+// context is done, the handler writes the buffered data and stops
+// like Close.
+func NewWithContext(ctx context.Context, c Config) *Handler {
 	if c.SyslogPriority == 0 {
 		c.SyslogPriority = syslog.LOG_INFO | syslog.LOG_LOCAL7
 	}
@@ -64,8 +235,23 @@ func New(c Config) *Handler {
 		writtenMinute: -1,
 		stop:          make(chan struct{}),
 		done:          make(chan struct{}),
+		sizes:         make(map[string]int),
+		spools:        make(map[string]*spool),
+		windows:       make(map[string]*window),
+		newest:        make(map[string]time.Time),
+		flushedAt:     make(map[string]time.Time),
+		emitted:       make(map[string]map[string]emitted),
+		stats:         newHandlerStats(),
+		accepted:      make(map[string]map[string]int),
+		flushRequests: make(chan string, 64),
+		retryLater:    make(map[string]bool),
+		conns:         newConnections(),
+		ctx:           ctx,
+		errs:          make(chan error, 16),
 		debug:         slog.Default().Enabled(nil, slog.LevelDebug),
 	}
+	h.spool = newSpool(c, h.debug)
+	h.flushed = sync.NewCond(&h.Mutex)
 
 	go h.scheduler()
 	return h
@@ -74,7 +260,21 @@ func New(c Config) *Handler {
 // Add adds the given data to the Sensorml handler.
 // The base name is optional and is used as the base name for the senml records.
 // If the base name is not set, the base name from the configuration is used.
+// The SenML value field depends on the Go type of each value: bool values
+// are written as vb, strings as vs, []byte as vd and numbers as v.
 func (h *Handler) Add(t time.Time, d map[string]any, baseName ...string) *Handler {
+	return h.AddWithMeta(t, d, nil, baseName...)
+}
+
+// AddWithMeta adds the given data like Add. The meta map contains optional
+// SenML fields (unit, sum) per key of d.
+//
+// Example:
+//
+//	handler.AddWithMeta(time.Now(),
+//		map[string]any{"temperature": 22.5, "door": "door_open", "energy": 1234},
+//		map[string]RecordMeta{"temperature": {Unit: "Cel"}, "energy": {Unit: "J", Sum: true}})
+func (h *Handler) AddWithMeta(t time.Time, d map[string]any, meta map[string]RecordMeta, baseName ...string) *Handler {
 	h.Lock()
 	defer h.Unlock()
 
@@ -83,57 +283,233 @@ func (h *Handler) Add(t time.Time, d map[string]any, baseName ...string) *Handle
 		bn = baseName[0]
 	}
 
-	if pack := h.add(t, d, bn); len(pack.Records) > 0 {
-		h.packs[bn] = pack
+	t, ok := h.checkTime(t, bn)
+	if !ok {
+		return h
+	}
+
+	if a, ok := h.config.Aggregation[bn]; ok && a.Window > 0 {
+		h.aggregate(t, d, meta, bn, a)
+		return h
 	}
 
+	h.append(t, d, meta, bn, true)
 	return h
 }
 
-// Close writes the data to the configured Out.
-// It returns an error if the writing fails.
+// append adds the data to the pack of the base name and applies
+// the pack limits, see makeRoom for block. The caller must hold the lock.
+func (h *Handler) append(t time.Time, d map[string]any, meta map[string]RecordMeta, bn string, block bool) {
+	if d = h.deadband(t, d, bn); len(d) == 0 {
+		return
+	}
+
+	if !h.makeRoom(bn, len(d), block) {
+		// the dropped values must not suppress the next ones
+		for key := range d {
+			delete(h.emitted[bn], key)
+		}
+		h.updateBuffered(0)
+		return
+	}
+
+	before := len(h.packs[bn].Records)
+	if pack := h.add(t, d, bn, meta); len(pack.Records) > 0 {
+		if _, ok := h.flushedAt[bn]; !ok {
+			h.flushedAt[bn] = time.Now()
+		}
+		h.packs[bn] = pack
+		if h.config.MaxBytesPerPack > 0 {
+			h.sizes[bn] += packSize(pack.Records[before:])
+		}
+		h.updateBuffered(len(pack.Records) - before)
+	}
+
+	// write a full pack immediately, not with the next interval
+	if h.full(bn) {
+		h.requestFlush(bn)
+	}
+}
+
+// Close stops the handler and writes the buffered data to the configured
+// outputs. It returns the error of this final flush.
+// Close can be called several times, every call returns the same error.
 func (h *Handler) Close() error {
-	h.stop <- struct{}{}
-	<-h.done
-	return nil
+	return h.CloseContext(context.Background())
+}
+
+// CloseContext closes the handler like Close. It returns ctx.Err() when
+// the final flush does not finish in time, the flush goes on in the
+// background.
+func (h *Handler) CloseContext(ctx context.Context) error {
+	h.stopOnce.Do(func() {
+		close(h.stop)
+	})
+
+	select {
+	case <-h.done:
+		return h.closeErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Errors returns a channel which receives the errors of the flushes
+// in the background, e.g. to react on persistent output failures.
+// Errors are dropped while the channel is full. The channel is closed
+// when the handler is closed.
+func (h *Handler) Errors() <-chan error {
+	return h.errs
+}
+
+// reportError logs the flush error and sends it to the Errors channel.
+func (h *Handler) reportError(err error) {
+	slog.Error("Error flushing data", "error", err.Error())
+	select {
+	case h.errs <- err:
+	default:
+	}
 }
 
 // Flush writes the data to the configured Out.
 // It returns an error if the writing fails.
+// When a SpoolDir is configured, spooled packs are replayed first and
+// packs which cannot be written are moved to the spool.
+// Aggregation windows which are not finished yet are kept.
 func (h *Handler) Flush() error {
-	var lastErr error
+	h.Lock()
+	defer h.Unlock()
+
+	// finished aggregation windows are written with this flush,
+	// on Close all running windows
+	h.closeWindows(h.closed)
+
+	// write base names in a stable order
+	var baseNames []string
+	for bn := range h.packs {
+		baseNames = append(baseNames, bn)
+	}
+	slices.Sort(baseNames)
 
+	return h.flush(baseNames)
+}
+
+// flushDue writes the packs whose flush interval ended, base names
+// with a Route can have a different FlushInterval.
+func (h *Handler) flushDue() error {
 	h.Lock()
 	defer h.Unlock()
 
-	for bn, p := range h.packs {
-		cfg := WriterConfig{
-			BaseName:       bn,
-			Out:            h.config.Out,
-			SyslogPriority: h.config.SyslogPriority,
-			debug:          h.debug,
+	h.closeWindows(h.closed)
+	return h.flush(h.due(time.Now()))
+}
+
+// flush writes the packs of the given base names, the caller must hold the lock.
+// A pack is removed when all outputs (or the quorum) accepted it.
+func (h *Handler) flush(baseNames []string) error {
+	var lastErr error
+	written := false
+
+	// replay spooled packs first to keep the order
+	for _, out := range h.allOutputs() {
+		s := h.spoolFor(out)
+		if s == nil {
+			continue
 		}
+		err := s.replay(func(p senml.Pack) error {
+			err := h.write(out, p)
+			written = written || err == nil
+			return err
+		})
+		if err != nil {
+			lastErr = err
+		}
+	}
+
+	for _, bn := range baseNames {
+		p, ok := h.packs[bn]
+		if !ok {
+			continue
+		}
+		h.flushedAt[bn] = time.Now()
 
 		// if the writing fails, the data is kept in the handler
 		// and will be written in the next minute
-		if err := NewWriter(cfg).AddPack(p).Write(); err != nil {
-			lastErr = err
-		} else {
-			delete(h.packs, bn)
+		cfg := h.configFor(bn)
+		outs := cfg.outputs()
+		accepted := 0
+		for _, out := range outs {
+			ok, err := h.flushTo(out, bn, p)
+			if err != nil {
+				lastErr = err
+			}
+			if ok {
+				accepted++
+			}
 		}
+		written = written || accepted > 0
+
+		if accepted < cfg.quorum(len(outs)) {
+			h.retryLater[bn] = true
+			continue
+		}
+		if accepted < len(outs) {
+			slog.Warn("senMlWriter pack removed by quorum", "baseName", bn,
+				"accepted", accepted, "outputs", len(outs))
+		}
+		h.removePack(bn)
 	}
 
+	// ticks without due packs are no flushes
+	if lastErr == nil && written {
+		h.countFlush()
+	}
 	return lastErr
 }
 
+// write writes the given pack to the given output.
+func (h *Handler) write(out string, p senml.Pack) error {
+	var bn string
+	if len(p.Records) > 0 {
+		bn = p.Records[0].BaseName
+	}
+	cfg := WriterConfig{
+		BaseName:       bn,
+		Out:            out,
+		SyslogPriority: h.config.SyslogPriority,
+		SyslogMaxSize:  h.config.SyslogMaxSize,
+		SyslogFormat:   h.config.SyslogFormat,
+		Encoding:       h.config.Encoding,
+		File:           h.config.File,
+		MQTT:           h.config.MQTT,
+		NATS:           h.config.NATS,
+		HTTP:           h.config.HTTP,
+		TLS:            h.config.TLS,
+		Envelope:       h.config.Envelope,
+		conns:          h.conns,
+		handler:        true,
+		debug:          h.debug,
+	}
+	w := NewWriter(cfg).AddPack(p)
+	err := w.Write()
+	h.countWrite(out, w.written, err)
+	return err
+}
+
 // add adds the given data to the Sensorml handler.
 // The data are sorted by key and added to the pack.
-func (h *Handler) add(t time.Time, data keyvalue.Record, baseName string) senml.Pack {
+// The optional meta map holds unit and sum settings per key.
+func (h *Handler) add(t time.Time, data keyvalue.Record, baseName string, meta ...map[string]RecordMeta) senml.Pack {
 
 	if len(data) == 0 {
 		return senml.Pack{}
 	}
 
+	var metaData map[string]RecordMeta
+	if len(meta) > 0 {
+		metaData = meta[0]
+	}
+
 	// get the first key of the data map
 	var keys []string
 	for k := range data {
@@ -142,12 +518,12 @@ func (h *Handler) add(t time.Time, data keyvalue.Record, baseName string) senml.
 	slices.Sort(keys)
 
 	var timeDelta float64
-	firstKey := keys[0]
-	firstValue := data.Float64(firstKey, true)
 
 	pack, ok := h.packs[baseName]
+	precision := h.configFor(baseName).TimePrecision
 
-	var add = func(r senml.Record) {
+	var add = func(r senml.Record, key string) {
+		setValue(&r, data[key], metaData[key])
 		if h.debug {
 			slog.Debug("senMlWriter add", "record", r)
 		}
@@ -161,39 +537,37 @@ func (h *Handler) add(t time.Time, data keyvalue.Record, baseName string) senml.
 		timeDelta = 0
 		add(senml.Record{
 			BaseName: baseName,
-			BaseTime: round(float64(t.UnixMilli())/1000, h.config.TimePrecision),
-			Name:     firstKey,
-			Value:    &firstValue,
-		})
+			BaseTime: round(float64(t.UnixMilli())/1000, precision),
+			Name:     keys[0],
+		}, keys[0])
 	} else {
-		// round to x decimal place to reduce digits
-		timeDelta = round(float64(t.UnixMilli())/1000-pack.Records[0].BaseTime, h.config.TimePrecision)
+		// round to x decimal place to reduce digits, the time is rounded
+		// like the base time first, otherwise 5s could become 4.99s
+		timeDelta = round(round(float64(t.UnixMilli())/1000, precision)-pack.Records[0].BaseTime, precision)
 		add(senml.Record{
-			Time:  timeDelta,
-			Name:  firstKey,
-			Value: &firstValue,
-		})
+			Time: timeDelta,
+			Name: keys[0],
+		}, keys[0])
 	}
 
 	// add all other records, ignore first key
 	for _, key := range keys[1:] {
-		v := data.Float64(key)
 		add(senml.Record{
-			Name:  key,
-			Value: &v,
-			Time:  timeDelta,
-		})
+			Name: key,
+			Time: timeDelta,
+		}, key)
 	}
 
 	return pack
 }
 
 // scheduler writes the data to the configured Out every minute.
-// The scheduler is stopped by closing the stop channel.
+// The scheduler is stopped by closing the stop channel or the context.
 // The data is written either every full second or minute (depending on the configuration).
 func (h *Handler) scheduler() {
 
-	interval := time.Second * time.Duration(h.config.FlushInterval)
+	// with routes the scheduler runs with the shortest interval
+	interval := h.interval()
 	wait := time.Until(time.Now().Truncate(interval).Add(interval))
 
 	timer := time.NewTimer(wait)
@@ -209,32 +583,66 @@ func (h *Handler) scheduler() {
 			}
 			timer.Stop()
 			ticker.Reset(interval)
-			err := h.Flush()
+			err := h.flushDue()
 			if err != nil {
-				slog.Error("Error flushing data", "error", err.Error())
+				h.reportError(err)
 			}
 		case <-ticker.C:
 			if h.debug {
-				slog.Debug("senMlWriter scheduler", "ticker.C", "h.Flush()")
+				slog.Debug("senMlWriter scheduler", "ticker.C", "h.flushDue()")
 			}
-			err := h.Flush()
+			err := h.flushDue()
 			if err != nil {
-				slog.Error("Error flushing data", "error", err.Error())
+				h.reportError(err)
+			}
+		case bn := <-h.flushRequests:
+			if h.debug {
+				slog.Debug("senMlWriter scheduler", "flushRequests", bn)
+			}
+			h.Lock()
+			var err error
+			// requests queued before a failed flush are dropped
+			if !h.retryLater[bn] {
+				err = h.flush([]string{bn})
+			}
+			h.Unlock()
+			if err != nil {
+				h.reportError(err)
 			}
 		case <-h.stop:
 			if h.debug {
 				slog.Debug("senMlWriter scheduler", "h.stop", "h.Flush()")
 			}
-			err := h.Flush()
-			if err != nil {
-				slog.Error("Error flushing data", "error", err.Error())
+			h.finish()
+			return
+		case <-h.ctx.Done():
+			if h.debug {
+				slog.Debug("senMlWriter scheduler", "ctx.Done", "h.Flush()")
 			}
-			close(h.done)
+			h.finish()
 			return
 		}
 	}
 }
 
+// finish writes the buffered data when the handler is closed.
+func (h *Handler) finish() {
+	h.Lock()
+	h.closed = true
+	h.flushed.Broadcast()
+	h.Unlock()
+
+	err := h.Flush()
+	if err != nil {
+		h.reportError(err)
+	}
+	_ = h.conns.close()
+
+	h.closeErr = err
+	close(h.errs)
+	close(h.done)
+}
+
 // Round rounds the given float to the given precision.
 // The precision is the number of digits after the decimal point.
 func round(val float64, precision int) float64 {
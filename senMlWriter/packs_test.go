@@ -1,9 +1,11 @@
 package senMlWriter
 
 import (
+	"context"
 	"fmt"
 	"github.com/mainflux/senml"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"testing"
 	"time"
 )
@@ -201,3 +203,107 @@ func Test_Example2(t *testing.T) {
 	fmt.Println("hu/train1/wagon1/advantech3231/e0673922ebd5/gps/", len(handler.packs["hu/train1/wagon1/advantech3231/e0673922ebd5/gps/"].Records), "values added")
 	fmt.Println("hu/train1/wagon1/advantech3231/e0673922ebd5/gps/", len(handler.packs["hu/train1/wagon1/advantech3231/e0673922ebd5/wago/"].Records), "values added")
 }
+
+func TestAddWithTypedValues(t *testing.T) {
+	handler := New(Config{TimePrecision: 2, FlushInterval: 1})
+	handler.Close()
+
+	data := map[string]any{"door": "door_open", "running": true, "raw": []byte{0x01, 0xff}, "counter": int64(42), "voltage": float32(1.5)}
+	result := handler.add(time.Now(), data, "wago/")
+
+	assert.Equal(t, 5, len(result.Records))
+	byName := map[string]senml.Record{}
+	for _, r := range result.Records {
+		byName[r.Name] = r
+	}
+
+	assert.Equal(t, "door_open", *byName["door"].StringValue)
+	assert.Nil(t, byName["door"].Value)
+	assert.Equal(t, true, *byName["running"].BoolValue)
+	assert.Nil(t, byName["running"].Value)
+	assert.Equal(t, "Af8", *byName["raw"].DataValue)
+	assert.Equal(t, 42.0, *byName["counter"].Value)
+	assert.Equal(t, 1.5, *byName["voltage"].Value)
+	assert.NoError(t, senml.Validate(result))
+}
+
+func TestAddWithMetaSetsUnitAndSum(t *testing.T) {
+	handler := New(Config{TimePrecision: 2, FlushInterval: 1})
+	handler.Close()
+
+	handler.AddWithMeta(time.Now(),
+		map[string]any{"temperature": 22.5, "energy": 1234},
+		map[string]RecordMeta{"temperature": {Unit: "Cel"}, "energy": {Unit: "J", Sum: true}},
+		"environment")
+
+	records := handler.packs["environment"].Records
+	assert.Equal(t, 2, len(records))
+
+	assert.Equal(t, "energy", records[0].Name)
+	assert.Equal(t, "J", records[0].Unit)
+	assert.Nil(t, records[0].Value)
+	assert.Equal(t, 1234.0, *records[0].Sum)
+
+	assert.Equal(t, "temperature", records[1].Name)
+	assert.Equal(t, "Cel", records[1].Unit)
+	assert.Equal(t, 22.5, *records[1].Value)
+	assert.Nil(t, records[1].Sum)
+}
+
+func TestCloseIsIdempotentAndReturnsFlushError(t *testing.T) {
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, Out: unreachableOut})
+	handler.Add(time.Now(), map[string]any{"speed": 80}, "train/")
+
+	err := handler.Close()
+	assert.Error(t, err)
+	assert.Equal(t, err, handler.Close())
+
+	handler = New(Config{TimePrecision: 2, FlushInterval: 3600})
+	assert.NoError(t, handler.Close())
+	assert.NoError(t, handler.Close())
+}
+
+func TestCloseWithDeadline(t *testing.T) {
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, Out: unreachableOut})
+
+	// the scheduler is busy with a flush
+	handler.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, handler.CloseContext(ctx), context.DeadlineExceeded)
+	handler.Unlock()
+
+	assert.NoError(t, handler.Close())
+}
+
+func TestNewWithContextClosesHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	handler := NewWithContext(ctx, Config{TimePrecision: 2, FlushInterval: 3600, Out: unreachableOut})
+	handler.Add(time.Now(), map[string]any{"speed": 80}, "train/")
+
+	cancel()
+
+	var errs []error
+	for err := range handler.Errors() {
+		errs = append(errs, err)
+	}
+	assert.Equal(t, 1, len(errs))
+	assert.Equal(t, errs[0], handler.Close())
+}
+
+func TestErrorsReceivesFlushErrors(t *testing.T) {
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, MaxRecordsPerPack: 1, Out: unreachableOut})
+	defer handler.Close()
+
+	handler.Add(time.Now(), map[string]any{"speed": 80}, "train/")
+
+	select {
+	case err := <-handler.Errors():
+		assert.Contains(t, err.Error(), "connection refused")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no flush error received")
+	}
+}
+
+// the handler is closed by code which only knows io.Closer
+var _ io.Closer = (*Handler)(nil)
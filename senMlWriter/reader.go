@@ -0,0 +1,253 @@
+package senMlWriter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mainflux/senml"
+
+	"github.com/itdesign-at/golib/keyvalue"
+)
+
+var ErrNoPack = errors.New("no SenML pack found")
+
+// relativeTimeLimit is 2**28 seconds, smaller times are relative
+// to the current time, see RFC 8428 section 4.5.3.
+const relativeTimeLimit = 1 << 28
+
+// Sample holds all values of one base name at one point in time.
+// It is the counterpart of the data passed to Handler.Add.
+type Sample struct {
+	Time     time.Time
+	BaseName string
+	Data     keyvalue.Record
+}
+
+// Decode decodes a SenML pack in the given encoding. An empty encoding
+// detects the encoding by the first byte of b.
+func Decode(b []byte, enc Encoding) (senml.Pack, error) {
+	text := bytes.TrimSpace(b)
+	if len(text) == 0 {
+		return senml.Pack{}, ErrNoPack
+	}
+
+	if enc == "" {
+		enc = detectEncoding(text)
+	}
+
+	// CBOR is binary, white space must not be removed
+	if enc != EncodingCBOR {
+		b = text
+	}
+
+	switch enc {
+	case EncodingJSON:
+		return senml.Decode(b, senml.JSON)
+	case EncodingCBOR:
+		return senml.Decode(b, senml.CBOR)
+	case EncodingXML:
+		return senml.Decode(b, senml.XML)
+	case EncodingJSONLines:
+		var p senml.Pack
+		scanner := bufio.NewScanner(bytes.NewReader(b))
+		scanner.Buffer(make([]byte, 0, 64*1024), len(b)+1)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			var r senml.Record
+			if err := json.Unmarshal(line, &r); err != nil {
+				return senml.Pack{}, err
+			}
+			p.Records = append(p.Records, r)
+		}
+		if err := scanner.Err(); err != nil {
+			return senml.Pack{}, err
+		}
+		return p, senml.Validate(p)
+	}
+	return senml.Pack{}, ErrUnknownEncoding
+}
+
+// ReadFile reads a SenML file written by SenMl2File. The encoding
+// is taken from the file extension (json, cbor, xml or jsonl) and
+// detected from the content for all other extensions. Files with
+// the extension .gz or .zst are decompressed.
+func ReadFile(fileName string) (senml.Pack, error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return senml.Pack{}, err
+	}
+
+	c, name := compressionOf(fileName)
+	if b, err = c.decompress(b); err != nil {
+		return senml.Pack{}, err
+	}
+
+	var enc Encoding
+	switch e := Encoding(strings.TrimPrefix(filepath.Ext(name), ".")); e {
+	case EncodingJSON, EncodingCBOR, EncodingXML, EncodingJSONLines:
+		enc = e
+	}
+
+	return Decode(b, enc)
+}
+
+// ParseSyslog decodes the SenML pack of a syslog message as written by
+// SenMl2Syslog. The syslog header (priority, time stamp, host and tag)
+// in front of the JSON array is skipped.
+func ParseSyslog(message []byte) (senml.Pack, error) {
+	i := bytes.Index(message, []byte("[{"))
+	if i < 0 {
+		return senml.Pack{}, ErrNoPack
+	}
+	return Decode(message[i:], EncodingJSON)
+}
+
+// Resolve resolves all base fields of the pack and returns one
+// keyvalue.Record per SenML record with these keys:
+//
+//	"baseName" string    ... base name in effect for the record
+//	"name"     string    ... name relative to the base name
+//	"fullName" string    ... base name + name
+//	"time"     time.Time ... absolute time
+//	"value"    any       ... float64, string, bool or []byte, base value applied
+//	"unit"     string    ... unit or base unit, only when set
+//	"sum"      float64   ... sum with base sum applied, only when set
+//
+// The records are returned in pack order.
+func Resolve(p senml.Pack) ([]keyvalue.Record, error) {
+	if err := senml.Validate(p); err != nil {
+		return nil, err
+	}
+
+	var (
+		bn, bu     string
+		bt, bv, bs float64
+		now        = time.Now()
+		resolved   = make([]keyvalue.Record, 0, len(p.Records))
+	)
+
+	for _, r := range p.Records {
+		if r.BaseName != "" {
+			bn = r.BaseName
+		}
+		if r.BaseTime != 0 {
+			bt = r.BaseTime
+		}
+		if r.BaseUnit != "" {
+			bu = r.BaseUnit
+		}
+		if r.BaseValue != 0 {
+			bv = r.BaseValue
+		}
+		if r.BaseSum != 0 {
+			bs = r.BaseSum
+		}
+
+		t := bt + r.Time
+		var ts time.Time
+		if t < relativeTimeLimit {
+			ts = now.Add(time.Duration(t * float64(time.Second)))
+		} else {
+			ts = time.UnixMilli(int64(math.Round(t * 1000)))
+		}
+
+		rec := keyvalue.Record{
+			"baseName": bn,
+			"name":     r.Name,
+			"fullName": bn + r.Name,
+			"time":     ts,
+		}
+
+		switch {
+		case r.Value != nil:
+			rec["value"] = bv + *r.Value
+		case r.StringValue != nil:
+			rec["value"] = *r.StringValue
+		case r.BoolValue != nil:
+			rec["value"] = *r.BoolValue
+		case r.DataValue != nil:
+			b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(*r.DataValue, "="))
+			if err != nil {
+				return nil, err
+			}
+			rec["value"] = b
+		}
+
+		if r.Sum != nil {
+			rec["sum"] = bs + *r.Sum
+		}
+
+		if r.Unit != "" {
+			rec["unit"] = r.Unit
+		} else if bu != "" {
+			rec["unit"] = bu
+		}
+
+		resolved = append(resolved, rec)
+	}
+
+	return resolved, nil
+}
+
+// Samples resolves the pack and groups the values by base name and
+// time. It returns the samples in the order they occur in the pack.
+// Records without a value but with a sum contribute their sum.
+func Samples(p senml.Pack) ([]Sample, error) {
+	records, err := Resolve(p)
+	if err != nil {
+		return nil, err
+	}
+
+	type sampleKey struct {
+		baseName string
+		time     int64
+	}
+
+	var samples []Sample
+	index := make(map[sampleKey]int)
+
+	for _, r := range records {
+		bn := r.String("baseName")
+		ts := r.Value("time").(time.Time)
+		key := sampleKey{baseName: bn, time: ts.UnixMilli()}
+
+		i, ok := index[key]
+		if !ok {
+			i = len(samples)
+			index[key] = i
+			samples = append(samples, Sample{Time: ts, BaseName: bn, Data: keyvalue.NewRecord()})
+		}
+
+		if r.Exists("value") {
+			samples[i].Data[r.String("name")] = r["value"]
+		} else if r.Exists("sum") {
+			samples[i].Data[r.String("name")] = r["sum"]
+		}
+	}
+
+	return samples, nil
+}
+
+// detectEncoding returns the encoding of b by its first byte.
+func detectEncoding(b []byte) Encoding {
+	switch b[0] {
+	case '[':
+		return EncodingJSON
+	case '{':
+		return EncodingJSONLines
+	case '<':
+		return EncodingXML
+	}
+	return EncodingCBOR
+}
@@ -0,0 +1,86 @@
+package senMlWriter
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mainflux/senml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveAppliesBaseFields(t *testing.T) {
+	v, s := 2.5, 10.0
+	p := senml.Pack{Records: []senml.Record{
+		{BaseName: "urn:dev:", BaseTime: 1714557600, BaseUnit: "Cel", BaseValue: 20, BaseSum: 100, Name: "temp", Value: &v},
+		{Name: "energy", Unit: "J", Time: 1.5, Sum: &s},
+	}}
+
+	records, err := Resolve(p)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(records))
+
+	assert.Equal(t, "urn:dev:temp", records[0].String("fullName"))
+	assert.Equal(t, "temp", records[0].String("name"))
+	assert.Equal(t, 22.5, records[0].Float64("value"))
+	assert.Equal(t, "Cel", records[0].String("unit"))
+	assert.Equal(t, time.Unix(1714557600, 0), records[0].Value("time"))
+
+	assert.Equal(t, "urn:dev:", records[1].String("baseName"))
+	assert.Equal(t, 110.0, records[1].Float64("sum"))
+	assert.Equal(t, "J", records[1].String("unit"))
+	assert.Equal(t, time.UnixMilli(1714557601500), records[1].Value("time"))
+}
+
+func TestDecodeDetectsEncoding(t *testing.T) {
+	for _, enc := range []Encoding{EncodingJSON, EncodingCBOR, EncodingXML, EncodingJSONLines} {
+		b, err := enc.Encode(testPack())
+		assert.NoError(t, err, enc)
+
+		p, err := Decode(b, "")
+		assert.NoError(t, err, enc)
+		assert.Equal(t, testPack().Records, p.Records, enc)
+	}
+}
+
+func TestParseSyslog(t *testing.T) {
+	message := []byte(`<190>2024-05-01T10:00:00+02:00 gateway senml02[1234]: [{"bn":"gps/","bt":1714557600,"n":"speed","v":64.2}]`)
+
+	p, err := ParseSyslog(message)
+	assert.NoError(t, err)
+	assert.Equal(t, "gps/", p.Records[0].BaseName)
+	assert.Equal(t, 64.2, *p.Records[0].Value)
+
+	_, err = ParseSyslog([]byte("<190>no senml here"))
+	assert.ErrorIs(t, err, ErrNoPack)
+}
+
+func TestHandlerRoundTrip(t *testing.T) {
+	dir := outputDir(t)
+	for _, enc := range []Encoding{EncodingJSON, EncodingCBOR, EncodingXML, EncodingJSONLines} {
+		handler := New(Config{TimePrecision: 3, FlushInterval: 60, Encoding: enc,
+			Out: "file:" + filepath.Join(dir, "{{.baseName}}.{{.extension}}")})
+
+		t0 := time.UnixMilli(1714557600123)
+		data1 := map[string]any{"latitude": 47.601987, "door": "door_open", "running": true, "raw": []byte("raw")}
+		data2 := map[string]any{"latitude": 47.601985, "door": "door_closed", "running": false, "raw": []byte("data")}
+		handler.Add(t0, data1, "gps/")
+		handler.Add(t0.Add(1500*time.Millisecond), data2, "gps/")
+		assert.NoError(t, handler.Flush(), enc)
+		_ = handler.Close()
+
+		p, err := ReadFile(filepath.Join(dir, "gps."+enc.Extension()))
+		assert.NoError(t, err, enc)
+
+		samples, err := Samples(p)
+		assert.NoError(t, err, enc)
+		assert.Equal(t, 2, len(samples), enc)
+
+		assert.Equal(t, "gps/", samples[0].BaseName)
+		assert.True(t, t0.Equal(samples[0].Time), enc)
+		assert.Equal(t, data1, map[string]any(samples[0].Data), enc)
+
+		assert.True(t, t0.Add(1500*time.Millisecond).Equal(samples[1].Time), enc)
+		assert.Equal(t, data2, map[string]any(samples[1].Data), enc)
+	}
+}
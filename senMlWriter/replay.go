@@ -0,0 +1,236 @@
+package senMlWriter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mainflux/senml"
+)
+
+// ReplayConfig holds the options of Replay.
+type ReplayConfig struct {
+	// Dir is the directory with the files written by SenMl2File,
+	// including its sub directories.
+	Dir string `json:"dir" yaml:"dir"`
+
+	// From and To limit the records to From <= time < To,
+	// a zero time means unlimited.
+	From time.Time `json:"from" yaml:"from"`
+	To   time.Time `json:"to" yaml:"to"`
+
+	// BaseNames are prefixes of the base names to replay, empty means all.
+	BaseNames []string `json:"baseNames" yaml:"baseNames"`
+
+	// Writer holds the Out and the options the packs are written with,
+	// e.g. "syslog://collector:514/senml".
+	Writer WriterConfig `json:"writer" yaml:"writer"`
+
+	// Rate limits the written packs per second, 0 means unlimited.
+	Rate float64 `json:"rate" yaml:"rate"`
+
+	// Checkpoint is an optional file which lists the finished files.
+	// They are skipped when Replay is started again.
+	Checkpoint string `json:"checkpoint" yaml:"checkpoint"`
+
+	// Envelope holds the keys to read files written with an Envelope.
+	Envelope EnvelopeConfig `json:"envelope" yaml:"envelope"`
+}
+
+// ReplayStats holds the counters of Replay.
+type ReplayStats struct {
+	// Files counts the finished files, Skipped the files finished
+	// before according to the Checkpoint
+	Files   int `json:"files" yaml:"files"`
+	Skipped int `json:"skipped" yaml:"skipped"`
+
+	// Broken counts the files which could not be read
+	Broken int `json:"broken" yaml:"broken"`
+
+	// Packs and Records count the written packs and records
+	Packs   int `json:"packs" yaml:"packs"`
+	Records int `json:"records" yaml:"records"`
+}
+
+// replayExtensions are the extensions of the files written by SenMl2File
+var replayExtensions = []string{".json", ".cbor", ".xml", ".jsonl", ".env"}
+
+// Replay writes the archived packs in Dir to the Out of the Writer, e.g.
+// after a collector was down. The files are read in the order of their
+// names, filtered by time and base name and written with one pack per
+// base name through Writer.Write. Files which cannot be read are skipped
+// with a warning.
+// Replay stops at the first write error or when the context is done, a
+// finished file is added to the Checkpoint. A file is replayed completely
+// again after an error, so packs can be written twice (at least once).
+//
+// Example:
+//
+//	stats, err := Replay(ctx, ReplayConfig{
+//		Dir:        "/var/lib/senml/2024/05",
+//		From:       time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+//		To:         time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+//		BaseNames:  []string{"hu/train1/"},
+//		Writer:     WriterConfig{Out: "syslog://collector:514/senml"},
+//		Rate:       50,
+//		Checkpoint: "/var/lib/senml/replay.checkpoint",
+//	})
+func Replay(ctx context.Context, c ReplayConfig) (ReplayStats, error) {
+	var stats ReplayStats
+
+	finished, err := readCheckpoint(c.Checkpoint)
+	if err != nil {
+		return stats, err
+	}
+
+	cfg := c.Writer
+	cfg.conns = newConnections()
+	defer cfg.conns.close()
+
+	var interval time.Duration
+	if c.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / c.Rate)
+	}
+	var next time.Time
+
+	err = filepath.WalkDir(c.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !replayable(path) {
+			return err
+		}
+		rel, err := filepath.Rel(c.Dir, path)
+		if err != nil {
+			return err
+		}
+		if finished[rel] {
+			stats.Skipped++
+			return nil
+		}
+
+		var p senml.Pack
+		if _, name := compressionOf(path); filepath.Ext(name) == ".env" {
+			p, err = ReadEnvelopeFile(path, c.Envelope)
+		} else {
+			p, err = ReadFile(path)
+		}
+		if err != nil {
+			slog.Warn("senMlWriter replay skips file", "file", path, "error", err.Error())
+			stats.Broken++
+			return nil
+		}
+
+		for _, p := range c.filter(p) {
+			if interval > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(time.Until(next)):
+				}
+				next = time.Now().Add(interval)
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if err := NewWriter(cfg).AddPack(p).Write(); err != nil {
+				return fmt.Errorf("replay %s: %w", rel, err)
+			}
+			stats.Packs++
+			stats.Records += len(p.Records)
+		}
+
+		stats.Files++
+		return appendCheckpoint(c.Checkpoint, rel)
+	})
+	return stats, err
+}
+
+// replayable returns true for the files written by SenMl2File.
+func replayable(path string) bool {
+	if strings.HasSuffix(path, ".tmp") || strings.HasSuffix(path, ".broken") {
+		return false
+	}
+	_, name := compressionOf(path)
+	return slices.Contains(replayExtensions, filepath.Ext(name))
+}
+
+// filter returns the records within the time range and base names,
+// one pack per base name. The first record of every pack and every
+// record with other base fields than the record before carry the
+// base fields in effect.
+func (c ReplayConfig) filter(p senml.Pack) []senml.Pack {
+	var packs []senml.Pack
+	var base, last senml.Record
+	for _, r := range p.Records {
+		inheritBase(&base, r)
+
+		t := time.UnixMilli(int64(math.Round((base.BaseTime + r.Time) * 1000)))
+		if !c.From.IsZero() && t.Before(c.From) || !c.To.IsZero() && !t.Before(c.To) {
+			continue
+		}
+		if len(c.BaseNames) > 0 && !slices.ContainsFunc(c.BaseNames, func(prefix string) bool {
+			return strings.HasPrefix(base.BaseName, prefix)
+		}) {
+			continue
+		}
+
+		switch {
+		case len(packs) == 0 || base.BaseName != last.BaseName:
+			packs = append(packs, senml.Pack{})
+			r = withBase(r, base)
+		case base != last:
+			r = withBase(r, base)
+		default:
+			r = withBase(r, senml.Record{})
+		}
+		last = base
+		packs[len(packs)-1].Records = append(packs[len(packs)-1].Records, r)
+	}
+	return packs
+}
+
+// readCheckpoint returns the finished files of the checkpoint file.
+func readCheckpoint(fileName string) (map[string]bool, error) {
+	finished := make(map[string]bool)
+	if fileName == "" {
+		return finished, nil
+	}
+
+	f, err := os.Open(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return finished, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			finished[line] = true
+		}
+	}
+	return finished, scanner.Err()
+}
+
+// appendCheckpoint adds the finished file to the checkpoint file.
+func appendCheckpoint(fileName, finished string) error {
+	if fileName == "" {
+		return nil
+	}
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(finished + "\n")
+	return errors.Join(err, f.Close())
+}
@@ -0,0 +1,141 @@
+package senMlWriter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mainflux/senml"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeArchive writes files like SenMl2File with a handler into dir.
+func writeArchive(t *testing.T, dir string, t0 time.Time) {
+	for _, c := range []Config{
+		{Out: "file:" + filepath.Join(dir, "2006/01/02/{{.baseName}}.{{.extension}}")},
+		{Out: "file:" + filepath.Join(dir, "2006/01/02/{{.baseName}}.{{.extension}}"), File: FileConfig{Compression: CompressionGzip}},
+	} {
+		c.TimePrecision, c.FlushInterval = 2, 3600
+		handler := New(c)
+		bn := "hu/train1/gps/"
+		if c.File.Compression != "" {
+			bn = "hu/train2/gps/"
+		}
+		for i := 0; i < 4; i++ {
+			handler.Add(t0.Add(time.Duration(i)*time.Second), map[string]any{"speed": float64(i)}, bn)
+		}
+		assert.NoError(t, handler.Close())
+	}
+}
+
+func TestReplay(t *testing.T) {
+	dir := outputDir(t)
+	t0 := time.Unix(1714557600, 0)
+	writeArchive(t, dir, t0)
+
+	day := filepath.Join(dir, t0.Format("2006/01/02"))
+	assert.NoError(t, os.WriteFile(filepath.Join(day, "broken.json"), []byte("no senml"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(day, "partial.json.tmp"), []byte("[{"), 0o644))
+
+	sink := Memory("TestReplay")
+	defer sink.Reset()
+
+	c := ReplayConfig{
+		Dir:        dir,
+		From:       t0.Add(time.Second),
+		To:         t0.Add(3 * time.Second),
+		BaseNames:  []string{"hu/train1/"},
+		Writer:     WriterConfig{Out: "memory:TestReplay"},
+		Checkpoint: filepath.Join(t.TempDir(), "replay.checkpoint"),
+	}
+	stats, err := Replay(context.Background(), c)
+	assert.NoError(t, err)
+	assert.Equal(t, ReplayStats{Files: 2, Broken: 1, Packs: 1, Records: 2}, stats)
+
+	packs := sink.Packs()
+	assert.Len(t, packs, 1)
+	samples, err := Samples(packs[0])
+	assert.NoError(t, err)
+	assert.Len(t, samples, 2)
+	for i, s := range samples {
+		assert.Equal(t, "hu/train1/gps/", s.BaseName)
+		assert.Equal(t, t0.Add(time.Duration(i+1)*time.Second), s.Time)
+		assert.Equal(t, float64(i+1), s.Data["speed"])
+	}
+
+	// the finished files are skipped, the broken one is read again
+	stats, err = Replay(context.Background(), c)
+	assert.NoError(t, err)
+	assert.Equal(t, ReplayStats{Skipped: 2, Broken: 1}, stats)
+	assert.Len(t, sink.Packs(), 1)
+
+	// without filter and checkpoint all records of both files
+	sink.Reset()
+	stats, err = Replay(context.Background(), ReplayConfig{Dir: dir, Writer: WriterConfig{Out: "memory:TestReplay"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 8, stats.Records)
+	assert.Len(t, sink.Packs(), 2)
+}
+
+func TestReplayStopsAtWriteError(t *testing.T) {
+	dir := outputDir(t)
+	writeArchive(t, dir, time.Unix(1714557600, 0))
+	checkpoint := filepath.Join(t.TempDir(), "replay.checkpoint")
+
+	_, err := Replay(context.Background(), ReplayConfig{Dir: dir, Writer: WriterConfig{Out: unreachableOut},
+		Checkpoint: checkpoint})
+	assert.Error(t, err)
+	_, err = os.Stat(checkpoint)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestReplayRate(t *testing.T) {
+	dir := outputDir(t)
+	writeArchive(t, dir, time.Unix(1714557600, 0))
+	defer Memory("TestReplayRate").Reset()
+
+	start := time.Now()
+	stats, err := Replay(context.Background(), ReplayConfig{Dir: dir, Writer: WriterConfig{Out: "memory:TestReplayRate"},
+		Rate: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.Packs)
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+	// a cancelled context stops while waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Replay(ctx, ReplayConfig{Dir: dir, Writer: WriterConfig{Out: "memory:TestReplayRate"}, Rate: 1})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestReplayFilter(t *testing.T) {
+	var v1, v2, v3, v4 = 1.0, 2.0, 3.0, 4.0
+	p := senml.Pack{Records: []senml.Record{
+		{BaseName: "a/", BaseTime: 1714557600, Name: "x", Value: &v1},
+		{BaseName: "b/", Name: "x", Time: 1, Value: &v2},
+		{BaseTime: 1714557700, Name: "x", Value: &v3},
+		{Name: "y", Time: 1, Value: &v4},
+	}}
+
+	packs := ReplayConfig{BaseNames: []string{"b/"}}.filter(p)
+	assert.Len(t, packs, 1)
+	records := packs[0].Records
+	assert.Len(t, records, 3)
+	assert.Equal(t, "b/", records[0].BaseName)
+	assert.Equal(t, float64(1714557600), records[0].BaseTime)
+	// the new base time is kept
+	assert.Equal(t, float64(1714557700), records[1].BaseTime)
+	assert.Equal(t, "", records[2].BaseName)
+
+	packs = ReplayConfig{}.filter(p)
+	assert.Len(t, packs, 2)
+	assert.Equal(t, "a/", packs[0].Records[0].BaseName)
+	assert.Equal(t, "b/", packs[1].Records[0].BaseName)
+
+	samples, err := Samples(packs[1])
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(1714557601, 0), samples[0].Time)
+	assert.Equal(t, time.Unix(1714557700, 0), samples[1].Time)
+}
@@ -0,0 +1,91 @@
+package senMlWriter
+
+import (
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// enforceRetention removes files in dir which are older than maxAge and
+// removes the oldest files until all files are smaller than maxBytes.
+// Only files with the extension (e.g. ".json") and their compressed
+// variants are touched, other files in dir are kept. Sub directories are
+// included, directories which become empty by a removal are removed.
+func enforceRetention(dir, extension string, maxAge time.Duration, maxBytes int64) error {
+	if dir == "" || extension == "" || (maxAge <= 0 && maxBytes <= 0) {
+		return nil
+	}
+	dir = filepath.Clean(dir)
+
+	type file struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+
+	var files []file
+	var removed []string
+	var total int64
+
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// files of other programs and files which are written right now
+		if d.IsDir() || !retained(name, extension) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if maxAge > 0 && time.Since(fi.ModTime()) > maxAge {
+			slog.Info("senMlWriter retention removes expired file", "file", name)
+			if os.Remove(name) == nil {
+				removed = append(removed, name)
+			}
+			return nil
+		}
+		files = append(files, file{name: name, size: fi.Size(), modTime: fi.ModTime()})
+		total += fi.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// the oldest files are removed first
+	slices.SortFunc(files, func(a, b file) int {
+		return a.modTime.Compare(b.modTime)
+	})
+	for i := 0; maxBytes > 0 && total > maxBytes && i < len(files); i++ {
+		slog.Info("senMlWriter retention removes oldest file", "file", files[i].name)
+		if os.Remove(files[i].name) == nil {
+			removed = append(removed, files[i].name)
+		}
+		total -= files[i].size
+	}
+
+	// remove the directories of the removed files up to dir, os.Remove
+	// fails for directories which are not empty
+	for _, name := range removed {
+		for d := filepath.Dir(name); d != dir && strings.HasPrefix(d, dir); d = filepath.Dir(d) {
+			if os.Remove(d) != nil {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// retained returns true when the file has the extension, optionally
+// followed by the extension of a compression.
+func retained(name, extension string) bool {
+	_, name = compressionOf(name)
+	return filepath.Ext(name) == extension
+}
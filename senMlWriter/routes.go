@@ -0,0 +1,120 @@
+package senMlWriter
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Route overrides options of the Config for all base names starting
+// with Prefix. When several routes match, the longest prefix wins.
+// Fields which are not set keep the value of the Config.
+type Route struct {
+	// Prefix of the base names, e.g. "hu/train1/wagon1/gps/"
+	Prefix string `json:"prefix" yaml:"prefix"`
+
+	// Out, Outs and Quorum replace the outputs of the Config
+	// when Out or Outs is set.
+	Out    string   `json:"out" yaml:"out"`
+	Outs   []string `json:"outs" yaml:"outs"`
+	Quorum int      `json:"quorum" yaml:"quorum"`
+
+	// TimePrecision replaces the TimePrecision of the Config when set,
+	// a pointer because 0 (full seconds) is a valid precision.
+	TimePrecision *int `json:"timePrecision" yaml:"timePrecision"`
+
+	// FlushInterval in seconds replaces the FlushInterval of the Config.
+	FlushInterval int `json:"flushInterval" yaml:"flushInterval"`
+
+	// SyslogTag replaces the tag of all syslog outputs, e.g.
+	// "syslog://collector:514/senml" becomes "syslog://collector:514/gps".
+	SyslogTag string `json:"syslogTag" yaml:"syslogTag"`
+}
+
+// forBaseName returns the Config with the overrides of the Route
+// matching the base name.
+func (c Config) forBaseName(bn string) Config {
+	var route *Route
+	for i, r := range c.Routes {
+		if strings.HasPrefix(bn, r.Prefix) && (route == nil || len(r.Prefix) > len(route.Prefix)) {
+			route = &c.Routes[i]
+		}
+	}
+	if route == nil {
+		return c
+	}
+
+	if route.Out != "" || len(route.Outs) > 0 {
+		c.Out, c.Outs, c.Quorum = route.Out, route.Outs, route.Quorum
+	}
+	if route.TimePrecision != nil {
+		c.TimePrecision = *route.TimePrecision
+	}
+	if route.FlushInterval > 0 {
+		c.FlushInterval = route.FlushInterval
+	}
+	if route.SyslogTag != "" {
+		c.Out = withSyslogTag(c.Out, route.SyslogTag)
+		c.Outs = slices.Clone(c.Outs)
+		for i, out := range c.Outs {
+			c.Outs[i] = withSyslogTag(out, route.SyslogTag)
+		}
+	}
+	return c
+}
+
+// configFor returns the Config of the base name, see Config.Routes.
+func (h *Handler) configFor(bn string) Config {
+	if len(h.config.Routes) == 0 {
+		return h.config
+	}
+	return h.config.forBaseName(bn)
+}
+
+// allOutputs returns the outputs of the Config and of all routes.
+func (h *Handler) allOutputs() []string {
+	outs := h.outputs()
+	for _, r := range h.config.Routes {
+		for _, out := range h.config.forBaseName(r.Prefix).outputs() {
+			if !slices.Contains(outs, out) {
+				outs = append(outs, out)
+			}
+		}
+	}
+	return outs
+}
+
+// interval returns the shortest flush interval of the Config and all routes.
+func (h *Handler) interval() time.Duration {
+	seconds := h.config.FlushInterval
+	for _, r := range h.config.Routes {
+		if r.FlushInterval > 0 {
+			seconds = min(seconds, r.FlushInterval)
+		}
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// due returns the sorted base names whose flush interval ended since
+// their last flush. The caller must hold the lock.
+func (h *Handler) due(now time.Time) []string {
+	var baseNames []string
+	for bn := range h.packs {
+		interval := time.Duration(h.configFor(bn).FlushInterval) * time.Second
+		if now.Truncate(interval).After(h.flushedAt[bn]) {
+			baseNames = append(baseNames, bn)
+		}
+	}
+	slices.Sort(baseNames)
+	return baseNames
+}
+
+// withSyslogTag replaces the tag of a syslog output.
+func withSyslogTag(out, tag string) string {
+	scheme, rest, found := strings.Cut(out, "://")
+	if !found || !strings.HasPrefix(scheme, "syslog") {
+		return out
+	}
+	address, _, _ := strings.Cut(rest, "/")
+	return scheme + "://" + address + "/" + tag
+}
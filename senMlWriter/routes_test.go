@@ -0,0 +1,92 @@
+package senMlWriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutes(t *testing.T) {
+	defer Memory("TestRoutes").Reset()
+	defer Memory("TestRoutesGps").Reset()
+
+	seconds := 0
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, Out: "memory:TestRoutes",
+		Routes: []Route{
+			{Prefix: "hu/train1/", TimePrecision: &seconds},
+			{Prefix: "hu/train1/wagon1/gps/", Out: "memory:TestRoutesGps"},
+		}})
+	defer handler.Close()
+
+	t0 := time.Unix(1714557600, 0)
+	handler.Add(t0, map[string]any{"latitude": 47.6}, "hu/train1/wagon1/gps/")
+	handler.Add(t0.Add(1250*time.Millisecond), map[string]any{"latitude": 47.7}, "hu/train1/wagon1/gps/")
+	handler.Add(t0, map[string]any{"pressure": 5.1}, "hu/train1/wagon1/wago/")
+	handler.Add(t0.Add(1250*time.Millisecond), map[string]any{"pressure": 5.2}, "hu/train1/wagon1/wago/")
+	handler.Add(t0, map[string]any{"temperature": 21}, "office/")
+	assert.NoError(t, handler.Flush())
+
+	// the longest prefix wins: gps has its own output and
+	// the TimePrecision of the Config
+	gps := Memory("TestRoutesGps").Packs()
+	assert.Len(t, gps, 1)
+	assert.Equal(t, "hu/train1/wagon1/gps/", gps[0].Records[0].BaseName)
+	assert.Equal(t, 1.25, gps[0].Records[1].Time)
+
+	// wago uses the output of the Config and full seconds
+	packs := Memory("TestRoutes").Packs()
+	assert.Len(t, packs, 2)
+	assert.Equal(t, "hu/train1/wagon1/wago/", packs[0].Records[0].BaseName)
+	assert.Equal(t, float64(1), packs[0].Records[1].Time)
+	assert.Equal(t, "office/", packs[1].Records[0].BaseName)
+}
+
+func TestRouteSyslogTag(t *testing.T) {
+	c := Config{
+		Out:    "syslog://collector:514/senml",
+		Outs:   []string{"syslog+udp://127.0.0.1:514", "mqtt://broker/senml"},
+		Routes: []Route{{Prefix: "gps/", SyslogTag: "gps"}},
+	}
+
+	gps := c.forBaseName("gps/")
+	assert.Equal(t, "syslog://collector:514/gps", gps.Out)
+	assert.Equal(t, []string{"syslog+udp://127.0.0.1:514/gps", "mqtt://broker/senml"}, gps.Outs)
+
+	// the Config itself is not changed
+	assert.Equal(t, "syslog+udp://127.0.0.1:514", c.Outs[0])
+	assert.Equal(t, c.Out, c.forBaseName("wago/").Out)
+}
+
+func TestRouteFlushInterval(t *testing.T) {
+	handler := New(Config{TimePrecision: 2, FlushInterval: 86400, Out: "memory:TestRouteFlushInterval",
+		Routes: []Route{{Prefix: "fast/", FlushInterval: 1}}})
+	defer Memory("TestRouteFlushInterval").Reset()
+	defer handler.Close()
+
+	assert.Equal(t, time.Second, handler.interval())
+
+	handler.Add(time.Now(), map[string]any{"speed": 80}, "fast/")
+	handler.Add(time.Now(), map[string]any{"temperature": 21}, "slow/")
+
+	// the base names are due at the end of their interval
+	handler.Lock()
+	at := time.Date(2024, 5, 1, 10, 0, 0, 500_000_000, time.UTC)
+	handler.flushedAt["fast/"] = at
+	handler.flushedAt["slow/"] = at
+	assert.Empty(t, handler.due(at.Add(400*time.Millisecond)))
+	assert.Equal(t, []string{"fast/"}, handler.due(at.Add(time.Second)))
+	assert.Equal(t, []string{"fast/", "slow/"}, handler.due(at.Add(14*time.Hour)))
+	handler.flushedAt["fast/"] = time.Now()
+	handler.flushedAt["slow/"] = time.Now()
+	handler.Unlock()
+
+	// the scheduler writes fast/ every second, slow/ once a day
+	assert.Eventually(t, func() bool {
+		return len(Memory("TestRouteFlushInterval").Packs()) > 0
+	}, 3*time.Second, 50*time.Millisecond)
+	packs := Memory("TestRouteFlushInterval").Packs()
+	assert.Len(t, packs, 1)
+	assert.Equal(t, "fast/", packs[0].Records[0].BaseName)
+	assert.Equal(t, 1, handler.Stats().BufferedPacks)
+}
@@ -0,0 +1,112 @@
+package senMlWriter
+
+import (
+	"log/slog"
+
+	"github.com/mainflux/senml"
+)
+
+// SplitPack splits the pack into several valid SenML packs, each encoded
+// smaller than maxBytes in the given encoding. The base fields in effect
+// (base name, base time, base unit, base value, base sum and version) are
+// repeated in the first record of every pack, so each pack can be resolved
+// on its own. The record order is kept.
+// A single record larger than maxBytes is returned as its own pack.
+// maxBytes <= 0 returns the pack unchanged.
+func SplitPack(p senml.Pack, maxBytes int, enc Encoding) ([]senml.Pack, error) {
+	if maxBytes <= 0 || len(p.Records) == 0 {
+		return []senml.Pack{p}, nil
+	}
+
+	b, err := enc.Encode(p)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) <= maxBytes {
+		return []senml.Pack{p}, nil
+	}
+
+	var (
+		packs   []senml.Pack
+		current []senml.Record
+		size    int
+		base    senml.Record // base fields in effect
+	)
+
+	// recordSize returns the size of the record encoded as a pack
+	// of its own. The sum of these sizes is an upper bound of the
+	// size of the combined pack for all encodings.
+	var recordSize = func(r senml.Record) (int, error) {
+		b, err := enc.Encode(senml.Pack{Records: []senml.Record{r}})
+		return len(b), err
+	}
+
+	for _, r := range p.Records {
+		inheritBase(&base, r)
+
+		if len(current) == 0 {
+			// every pack starts with the base fields in effect
+			r = withBase(r, base)
+		}
+
+		s, err := recordSize(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(current) > 0 && size+s > maxBytes {
+			packs = append(packs, senml.Pack{Records: current})
+			current, size = nil, 0
+			r = withBase(r, base)
+			if s, err = recordSize(r); err != nil {
+				return nil, err
+			}
+		}
+
+		if s > maxBytes {
+			slog.Warn("senMlWriter SplitPack record exceeds limit", "name", r.Name, "bytes", s, "maxBytes", maxBytes)
+		}
+
+		current = append(current, r)
+		size += s
+	}
+
+	if len(current) > 0 {
+		packs = append(packs, senml.Pack{Records: current})
+	}
+
+	return packs, nil
+}
+
+// inheritBase copies the base fields set in r into base.
+func inheritBase(base *senml.Record, r senml.Record) {
+	if r.BaseName != "" {
+		base.BaseName = r.BaseName
+	}
+	if r.BaseTime != 0 {
+		base.BaseTime = r.BaseTime
+	}
+	if r.BaseUnit != "" {
+		base.BaseUnit = r.BaseUnit
+	}
+	if r.BaseValue != 0 {
+		base.BaseValue = r.BaseValue
+	}
+	if r.BaseSum != 0 {
+		base.BaseSum = r.BaseSum
+	}
+	if r.BaseVersion != 0 {
+		base.BaseVersion = r.BaseVersion
+	}
+}
+
+// withBase returns r with all base fields in effect set.
+func withBase(r senml.Record, base senml.Record) senml.Record {
+	r.BaseName = base.BaseName
+	r.BaseTime = base.BaseTime
+	r.BaseUnit = base.BaseUnit
+	r.BaseValue = base.BaseValue
+	r.BaseSum = base.BaseSum
+	r.BaseVersion = base.BaseVersion
+	return r
+}
@@ -0,0 +1,121 @@
+package senMlWriter
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mainflux/senml"
+	"github.com/stretchr/testify/assert"
+)
+
+// bigPack returns a pack with n samples of two records each.
+func bigPack(n int) senml.Pack {
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600})
+	_ = handler.Close()
+
+	t0 := time.UnixMilli(1714557600000)
+	for i := 0; i < n; i++ {
+		handler.Add(t0.Add(time.Duration(i)*time.Second), map[string]any{"latitude": 47.6 + float64(i)/1000, "longitude": 17.2}, "hu/train1/gps/")
+	}
+	return handler.packs["hu/train1/gps/"]
+}
+
+func TestSplitPackKeepsPacksBelowLimit(t *testing.T) {
+	pack := bigPack(50)
+	expected, err := Resolve(pack)
+	assert.NoError(t, err)
+
+	for _, enc := range []Encoding{EncodingJSON, EncodingCBOR, EncodingXML, EncodingJSONLines} {
+		packs, err := SplitPack(pack, 512, enc)
+		assert.NoError(t, err, enc)
+		assert.Greater(t, len(packs), 1, enc)
+
+		var resolved []map[string]any
+		for _, p := range packs {
+			b, err := enc.Encode(p)
+			assert.NoError(t, err, enc)
+			assert.LessOrEqual(t, len(b), 512, enc)
+
+			// every pack must be resolvable on its own
+			assert.Equal(t, "hu/train1/gps/", p.Records[0].BaseName, enc)
+			assert.NotZero(t, p.Records[0].BaseTime, enc)
+
+			records, err := Resolve(p)
+			assert.NoError(t, err, enc)
+			for _, r := range records {
+				resolved = append(resolved, r)
+			}
+		}
+
+		assert.Equal(t, len(expected), len(resolved), enc)
+		for i := range expected {
+			assert.Equal(t, map[string]any(expected[i]), resolved[i], enc)
+		}
+	}
+}
+
+func TestSplitPackSmallPackUnchanged(t *testing.T) {
+	pack := bigPack(2)
+	packs, err := SplitPack(pack, 4096, EncodingJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, []senml.Pack{pack}, packs)
+
+	packs, err = SplitPack(pack, 0, EncodingJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, []senml.Pack{pack}, packs)
+}
+
+func TestSenMl2SyslogSplitsMessages(t *testing.T) {
+	server := startSyslogServer(t, nil, false)
+
+	w := NewWriter(WriterConfig{Out: "syslog://" + server.address + "/senml02", SyslogMaxSize: 1024})
+	assert.NoError(t, w.AddPack(bigPack(100)).Write())
+
+	records := 0
+	messages := 0
+	timeout := time.After(5 * time.Second)
+	for records < 200 {
+		select {
+		case line := <-server.lines:
+			messages++
+			p, err := ParseSyslog([]byte(line))
+			assert.NoError(t, err)
+			records += len(p.Records)
+		case <-timeout:
+			t.Fatalf("received %d of 200 records", records)
+		}
+	}
+	assert.Greater(t, messages, 1)
+}
+
+func TestSenMl2SyslogMaxSizeIncludesHeader(t *testing.T) {
+	const maxSize = 200
+
+	for _, format := range []SyslogFormat{SyslogFormatLegacy, SyslogFormatRFC5424} {
+		octetCounting := format == SyslogFormatRFC5424
+		server := startSyslogServer(t, nil, octetCounting)
+
+		w := NewWriter(WriterConfig{Out: "syslog://" + server.address + "/senml02",
+			SyslogMaxSize: maxSize, SyslogFormat: format})
+		assert.NoError(t, w.AddPack(bigPack(10)).Write())
+
+		records := 0
+		for records < 20 {
+			line := server.next(t)
+			// the length on the wire: newline or octet count
+			size := len(line) + 1
+			if octetCounting {
+				size += len(strconv.Itoa(len(line)))
+			}
+			assert.LessOrEqual(t, size, maxSize, format)
+
+			p, err := ParseSyslog([]byte(line))
+			assert.NoError(t, err)
+			records += len(p.Records)
+		}
+	}
+
+	w := NewWriter(WriterConfig{Out: "syslog://127.0.0.1:1/senml02", SyslogMaxSize: 20})
+	assert.ErrorIs(t, w.AddPack(testPack()).Write(), ErrInvalidConfig)
+}
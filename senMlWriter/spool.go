@@ -0,0 +1,228 @@
+package senMlWriter
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mainflux/senml"
+)
+
+// spoolExtension is the file extension of spooled packs.
+const spoolExtension = ".senml"
+
+// spool is a disk-backed store-and-forward queue for packs which
+// could not be written to the configured Out. Every pack is stored
+// in its own file named by a sequence number, which continues with
+// the highest number on disk after a restart. So the packs are
+// replayed in order, even when the clock jumps, e.g. by NTP after boot.
+type spool struct {
+	// dir is the directory where the packs are stored
+	dir string
+
+	// maxBytes limits the total size of all spooled packs, 0 = unlimited
+	maxBytes int64
+
+	// maxAge limits the age of a spooled pack, 0 = unlimited
+	maxAge time.Duration
+
+	// seq is the sequence number of the last spooled pack,
+	// 0 until the spool directory was read
+	seq uint64
+
+	debug bool
+}
+
+// newSpool returns a spool for the given configuration or nil when
+// no spool directory is configured.
+func newSpool(c Config, debug bool) *spool {
+	if c.SpoolDir == "" {
+		return nil
+	}
+	return &spool{
+		dir:      c.SpoolDir,
+		maxBytes: c.SpoolMaxBytes,
+		maxAge:   time.Duration(c.SpoolMaxAge) * time.Second,
+		debug:    debug,
+	}
+}
+
+// files returns the spooled file names in the order they were spooled.
+func (s *spool) files() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), spoolExtension) {
+			continue
+		}
+		files = append(files, e.Name())
+	}
+	slices.SortFunc(files, func(a, b string) int {
+		if c := cmp.Compare(spoolSeq(a), spoolSeq(b)); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	return files, nil
+}
+
+// spoolSeq returns the sequence number of a spooled file name. Files
+// spooled by older versions start with their time in nanoseconds,
+// which is taken as sequence number.
+func spoolSeq(name string) uint64 {
+	digits := strings.TrimSuffix(name, spoolExtension)
+	if i := strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		digits = digits[:i]
+	}
+	seq, _ := strconv.ParseUint(digits, 10, 64)
+	return seq
+}
+
+// empty returns true when there is nothing to replay.
+func (s *spool) empty() bool {
+	files, err := s.files()
+	return err == nil && len(files) == 0
+}
+
+// store writes the pack into the spool directory and enforces
+// the configured size and age limits afterwards.
+func (s *spool) store(p senml.Pack) error {
+	b, err := senml.Encode(p, senml.JSON)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(s.dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	if s.seq == 0 {
+		// continue with the highest sequence number on disk
+		files, err := s.files()
+		if err != nil {
+			return err
+		}
+		if len(files) > 0 {
+			s.seq = spoolSeq(files[len(files)-1])
+		}
+	}
+	s.seq++
+	fileName := filepath.Join(s.dir, fmt.Sprintf("%020d%s", s.seq, spoolExtension))
+
+	// write to tmp file first to avoid partial packs after a crash
+	err = os.WriteFile(fileName+".tmp", b, 0640)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(fileName+".tmp", fileName)
+	if err != nil {
+		return err
+	}
+
+	if s.debug {
+		slog.Debug("senMlWriter spool store", "file", fileName, "records", p.Len())
+	}
+
+	return s.enforceLimits()
+}
+
+// replay writes all spooled packs in order with the given write function.
+// Each pack written successfully is removed from the spool. The replay stops
+// at the first error to keep the order of the packs.
+func (s *spool) replay(write func(p senml.Pack) error) error {
+	if err := s.enforceLimits(); err != nil {
+		return err
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		fileName := filepath.Join(s.dir, f)
+		b, err := os.ReadFile(fileName)
+		if err != nil {
+			return err
+		}
+
+		p, err := senml.Decode(b, senml.JSON)
+		if err != nil {
+			// a broken file would block the spool forever
+			slog.Warn("senMlWriter spool drops unreadable pack", "file", fileName, "error", err.Error())
+			_ = os.Remove(fileName)
+			continue
+		}
+
+		if err = write(p); err != nil {
+			return err
+		}
+
+		if s.debug {
+			slog.Debug("senMlWriter spool replay", "file", fileName, "records", p.Len())
+		}
+
+		if err = os.Remove(fileName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// enforceLimits removes packs which are older than maxAge and
+// removes the oldest packs until the spool is smaller than maxBytes.
+func (s *spool) enforceLimits() error {
+	if s.maxBytes <= 0 && s.maxAge <= 0 {
+		return nil
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	type spooled struct {
+		name string
+		size int64
+	}
+
+	var kept []spooled
+	var total int64
+	for _, f := range files {
+		fileName := filepath.Join(s.dir, f)
+		fi, err := os.Stat(fileName)
+		if err != nil {
+			continue
+		}
+		if s.maxAge > 0 && time.Since(fi.ModTime()) > s.maxAge {
+			slog.Warn("senMlWriter spool drops expired pack", "file", fileName)
+			_ = os.Remove(fileName)
+			continue
+		}
+		kept = append(kept, spooled{name: fileName, size: fi.Size()})
+		total += fi.Size()
+	}
+
+	// the oldest packs are dropped first
+	for i := 0; s.maxBytes > 0 && total > s.maxBytes && i < len(kept); i++ {
+		slog.Warn("senMlWriter spool full, drops oldest pack", "file", kept[i].name)
+		_ = os.Remove(kept[i].name)
+		total -= kept[i].size
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package senMlWriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mainflux/senml"
+	"github.com/stretchr/testify/assert"
+)
+
+// unreachableOut points to a closed local port, the dial fails immediately
+const unreachableOut = "syslog://127.0.0.1:1/senml"
+
+// outputDir returns a temporary directory without digits in its name.
+// SenMl2File formats the whole file name as time layout, digits of
+// t.TempDir() would be replaced.
+func outputDir(t *testing.T) string {
+	const letters = "abcdefghijklnoqrsuvwxyz"
+	name := []byte("senmlwriter")
+	for _, c := range time.Now().Format("150405.000000000") {
+		if c >= '0' && c <= '9' {
+			name = append(name, letters[c-'0'])
+		}
+	}
+	dir := filepath.Join(os.TempDir(), string(name))
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+func TestFlushStoresFailedPacksInSpool(t *testing.T) {
+	spoolDir := t.TempDir()
+
+	handler := New(Config{TimePrecision: 2, FlushInterval: 60, Out: unreachableOut, SpoolDir: spoolDir})
+	defer handler.Close()
+
+	handler.Add(time.Now(), map[string]any{"temperature": 22.5}, "environment1/")
+	handler.Add(time.Now(), map[string]any{"humidity": 60}, "environment2/")
+
+	assert.Error(t, handler.Flush())
+	assert.Empty(t, handler.packs)
+
+	files, err := handler.spool.files()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(files))
+}
+
+func TestFlushReplaysSpoolInOrder(t *testing.T) {
+	spoolDir := t.TempDir()
+	outDir := outputDir(t)
+
+	handler := New(Config{TimePrecision: 2, FlushInterval: 60, Out: unreachableOut, SpoolDir: spoolDir})
+	defer handler.Close()
+
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	handler.Add(t0, map[string]any{"temperature": 22.5}, "environment/")
+	assert.Error(t, handler.Flush())
+
+	handler.Add(t0.Add(time.Minute), map[string]any{"temperature": 23.5}, "environment/")
+	assert.Error(t, handler.Flush())
+
+	// the destination is reachable again
+	handler.Lock()
+	handler.config.Out = "file:" + filepath.Join(outDir, "15-04.json")
+	handler.Unlock()
+
+	handler.Add(t0.Add(2*time.Minute), map[string]any{"temperature": 24.5}, "environment/")
+	assert.NoError(t, handler.Flush())
+
+	assert.True(t, handler.spool.empty())
+	for _, name := range []string{"10-00.json", "10-01.json", "10-02.json"} {
+		assert.FileExists(t, filepath.Join(outDir, name))
+	}
+}
+
+func TestSpoolSurvivesRestart(t *testing.T) {
+	spoolDir := t.TempDir()
+	outDir := outputDir(t)
+
+	handler := New(Config{TimePrecision: 2, FlushInterval: 60, Out: unreachableOut, SpoolDir: spoolDir})
+	handler.Add(time.Now(), map[string]any{"temperature": 22.5}, "environment")
+	// Close flushes into the spool
+	_ = handler.Close()
+
+	handler = New(Config{TimePrecision: 2, FlushInterval: 60, Out: "file:" + filepath.Join(outDir, "out.json"), SpoolDir: spoolDir})
+	defer handler.Close()
+
+	assert.NoError(t, handler.Flush())
+	assert.True(t, handler.spool.empty())
+
+	b, err := os.ReadFile(filepath.Join(outDir, "out.json"))
+	assert.NoError(t, err)
+	p, err := senml.Decode(b, senml.JSON)
+	assert.NoError(t, err)
+	assert.Equal(t, "environment", p.Records[0].BaseName)
+	assert.Equal(t, 22.5, *p.Records[0].Value)
+}
+
+func TestSpoolKeepsOrderAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	var pack = func(v float64) senml.Pack {
+		return senml.Pack{Records: []senml.Record{{BaseName: "bn", Name: "n", Value: &v}}}
+	}
+
+	// spooled by an older version while the clock was ahead
+	b, err := senml.Encode(pack(1), senml.JSON)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "2000000000000000000-000001.senml"), b, 0640))
+
+	// every new spool is a restart, the clock does not matter
+	assert.NoError(t, newSpool(Config{SpoolDir: dir}, false).store(pack(2)))
+	s := newSpool(Config{SpoolDir: dir}, false)
+	assert.NoError(t, s.store(pack(3)))
+	assert.NoError(t, s.store(pack(4)))
+
+	var values []float64
+	assert.NoError(t, newSpool(Config{SpoolDir: dir}, false).replay(func(p senml.Pack) error {
+		values = append(values, *p.Records[0].Value)
+		return nil
+	}))
+	assert.Equal(t, []float64{1, 2, 3, 4}, values)
+}
+
+func TestSpoolDropsOldestPacksWhenFull(t *testing.T) {
+	s := &spool{dir: t.TempDir(), maxBytes: 200}
+
+	for i := 0; i < 10; i++ {
+		v := float64(i)
+		assert.NoError(t, s.store(senml.Pack{Records: []senml.Record{{BaseName: "bn", Name: "n", Value: &v}}}))
+	}
+
+	files, err := s.files()
+	assert.NoError(t, err)
+	assert.Less(t, len(files), 10)
+
+	// the newest pack must survive
+	var values []float64
+	assert.NoError(t, s.replay(func(p senml.Pack) error {
+		values = append(values, *p.Records[0].Value)
+		return nil
+	}))
+	assert.Equal(t, 9.0, values[len(values)-1])
+}
+
+func TestSpoolDropsExpiredPacks(t *testing.T) {
+	s := &spool{dir: t.TempDir(), maxAge: time.Minute}
+
+	v := 1.0
+	assert.NoError(t, s.store(senml.Pack{Records: []senml.Record{{BaseName: "bn", Name: "n", Value: &v}}}))
+
+	files, _ := s.files()
+	old := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(s.dir, files[0]), old, old))
+
+	assert.NoError(t, s.enforceLimits())
+	assert.True(t, s.empty())
+}
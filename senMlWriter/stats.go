@@ -0,0 +1,234 @@
+package senMlWriter
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stats holds the counters of a Handler, see Handler.Stats.
+type Stats struct {
+	// RecordsAdded counts the records added to the packs
+	RecordsAdded int64 `json:"recordsAdded" yaml:"recordsAdded"`
+
+	// RecordsDropped counts the records dropped by the OverflowPolicy
+	RecordsDropped int64 `json:"recordsDropped" yaml:"recordsDropped"`
+
+	// LateSamples counts the samples older than the Watermark
+	LateSamples int64 `json:"lateSamples" yaml:"lateSamples"`
+
+	// ClockJumps counts the detected clock jumps, see Config.ClockJump
+	ClockJumps int64 `json:"clockJumps" yaml:"clockJumps"`
+
+	// FlushErrors counts the failed writes of all outputs
+	FlushErrors int64 `json:"flushErrors" yaml:"flushErrors"`
+
+	// BufferedPacks and BufferedRecords are waiting to be written
+	BufferedPacks   int `json:"bufferedPacks" yaml:"bufferedPacks"`
+	BufferedRecords int `json:"bufferedRecords" yaml:"bufferedRecords"`
+
+	// OldestPack is the time the oldest buffered pack was created,
+	// zero when no pack is buffered
+	OldestPack time.Time `json:"oldestPack" yaml:"oldestPack"`
+
+	// LastFlush is the time of the last flush which wrote packs without error
+	LastFlush time.Time `json:"lastFlush" yaml:"lastFlush"`
+
+	// Outputs holds the counters per output
+	Outputs map[string]OutputStats `json:"outputs" yaml:"outputs"`
+}
+
+// OutputStats holds the counters of one output.
+type OutputStats struct {
+	// Packs and Bytes count the packs and bytes written successfully
+	Packs int64 `json:"packs" yaml:"packs"`
+	Bytes int64 `json:"bytes" yaml:"bytes"`
+
+	// Errors counts the failed writes
+	Errors int64 `json:"errors" yaml:"errors"`
+
+	// LastSuccess is the time of the last successful write
+	LastSuccess time.Time `json:"lastSuccess" yaml:"lastSuccess"`
+
+	// LastError is the error of the last failed write
+	LastError string `json:"lastError" yaml:"lastError"`
+}
+
+// handlerStats holds the stats with a lock of its own, so reading
+// them does not wait for a running flush.
+type handlerStats struct {
+	sync.Mutex
+	Stats
+
+	// created holds the creation time per buffered base name
+	created map[string]time.Time
+}
+
+func newHandlerStats() *handlerStats {
+	return &handlerStats{
+		Stats:   Stats{Outputs: make(map[string]OutputStats)},
+		created: make(map[string]time.Time),
+	}
+}
+
+// Stats returns a copy of the counters of the handler.
+// It does not wait for a running flush.
+func (h *Handler) Stats() Stats {
+	h.stats.Lock()
+	defer h.stats.Unlock()
+
+	s := h.stats.Stats
+	s.Outputs = maps.Clone(s.Outputs)
+	return s
+}
+
+// updateBuffered copies the buffered packs and records into the
+// stats. The caller must hold the lock.
+func (h *Handler) updateBuffered(added int) {
+	records := 0
+	for _, p := range h.packs {
+		records += len(p.Records)
+	}
+
+	h.stats.Lock()
+	defer h.stats.Unlock()
+
+	now := time.Now()
+	for bn := range h.packs {
+		if _, ok := h.stats.created[bn]; !ok {
+			h.stats.created[bn] = now
+		}
+	}
+	var oldest time.Time
+	for bn, created := range h.stats.created {
+		if _, ok := h.packs[bn]; !ok {
+			delete(h.stats.created, bn)
+			continue
+		}
+		if oldest.IsZero() || created.Before(oldest) {
+			oldest = created
+		}
+	}
+
+	h.stats.RecordsAdded += int64(added)
+	h.stats.RecordsDropped = int64(h.dropped)
+	h.stats.BufferedPacks = len(h.packs)
+	h.stats.BufferedRecords = records
+	h.stats.OldestPack = oldest
+}
+
+// countWrite updates the stats of the output after a write.
+func (h *Handler) countWrite(out string, bytes int, err error) {
+	h.stats.Lock()
+	defer h.stats.Unlock()
+
+	o := h.stats.Outputs[out]
+	if err != nil {
+		o.Errors++
+		o.LastError = err.Error()
+		h.stats.FlushErrors++
+	} else {
+		o.Packs++
+		o.Bytes += int64(bytes)
+		o.LastSuccess = time.Now()
+	}
+	h.stats.Outputs[out] = o
+}
+
+// countFlush sets the time of the last flush without error.
+func (h *Handler) countFlush() {
+	h.stats.Lock()
+	defer h.stats.Unlock()
+	h.stats.LastFlush = time.Now()
+}
+
+// MetricsHandler returns a http.Handler which serves the stats in the
+// Prometheus text format, e.g. http.Handle("/metrics", handler.MetricsHandler()).
+// Passwords in the output label are redacted.
+func (h *Handler) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = w.Write([]byte(h.Stats().prometheus(time.Now())))
+	})
+}
+
+// prometheus formats the stats in the Prometheus text format.
+func (s Stats) prometheus(now time.Time) string {
+	var b strings.Builder
+
+	var metric = func(name, typ, help string, value any) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, typ, name, value)
+	}
+	var seconds = func(t time.Time) float64 {
+		if t.IsZero() {
+			return 0
+		}
+		return float64(t.UnixMilli()) / 1000
+	}
+
+	metric("senmlwriter_records_added_total", "counter", "Records added to the packs.", s.RecordsAdded)
+	metric("senmlwriter_records_dropped_total", "counter", "Records dropped by the overflow policy.", s.RecordsDropped)
+	metric("senmlwriter_late_samples_total", "counter", "Samples older than the watermark.", s.LateSamples)
+	metric("senmlwriter_clock_jumps_total", "counter", "Detected clock jumps.", s.ClockJumps)
+	metric("senmlwriter_flush_errors_total", "counter", "Failed writes of all outputs.", s.FlushErrors)
+	metric("senmlwriter_buffered_packs", "gauge", "Packs waiting to be written.", s.BufferedPacks)
+	metric("senmlwriter_buffered_records", "gauge", "Records waiting to be written.", s.BufferedRecords)
+
+	age := 0.0
+	if !s.OldestPack.IsZero() {
+		age = now.Sub(s.OldestPack).Seconds()
+	}
+	metric("senmlwriter_oldest_pack_age_seconds", "gauge", "Age of the oldest buffered pack.", age)
+	metric("senmlwriter_last_flush_timestamp_seconds", "gauge", "Unix time of the last flush without error.", seconds(s.LastFlush))
+
+	var outs []string
+	for out := range s.Outputs {
+		outs = append(outs, out)
+	}
+	slices.Sort(outs)
+	var perOutput = func(name, typ, help string, value func(o OutputStats) any) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, out := range outs {
+			fmt.Fprintf(&b, "%s{out=\"%s\"} %v\n", name, labelValue(out), value(s.Outputs[out]))
+		}
+	}
+	perOutput("senmlwriter_output_packs_total", "counter", "Packs written per output.",
+		func(o OutputStats) any { return o.Packs })
+	perOutput("senmlwriter_output_bytes_total", "counter", "Bytes written per output.",
+		func(o OutputStats) any { return o.Bytes })
+	perOutput("senmlwriter_output_errors_total", "counter", "Failed writes per output.",
+		func(o OutputStats) any { return o.Errors })
+	perOutput("senmlwriter_output_last_success_timestamp_seconds", "gauge", "Unix time of the last successful write per output.",
+		func(o OutputStats) any { return seconds(o.LastSuccess) })
+
+	return b.String()
+}
+
+// labelValue redacts the password of the output and escapes it
+// as Prometheus label value.
+func labelValue(out string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(redact(out))
+}
+
+// redact replaces the password of the output with "xxxxx". It does not
+// parse the output as URL, so invalid outputs are redacted as well.
+func redact(out string) string {
+	scheme, rest, found := strings.Cut(out, "://")
+	if !found {
+		return out
+	}
+	host, _, _ := strings.Cut(rest, "/")
+	i := strings.LastIndex(host, "@")
+	if i < 0 {
+		return out
+	}
+	user, _, ok := strings.Cut(host[:i], ":")
+	if !ok {
+		return out
+	}
+	return scheme + "://" + user + ":xxxxx" + rest[i:]
+}
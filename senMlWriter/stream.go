@@ -0,0 +1,48 @@
+package senMlWriter
+
+import "io"
+
+// NewWriterTo creates a new Writer like NewWriter which writes every pack
+// as one line of SenML JSON (NDJSON) to out, e.g. a bytes.Buffer in tests.
+// The Out of the configuration is ignored.
+//
+// Example:
+//
+//	var buf bytes.Buffer
+//	err := NewWriterTo(&buf).AddPack(p).Write()
+func NewWriterTo(out io.Writer, cfg ...WriterConfig) *Writer {
+	var c WriterConfig
+	if len(cfg) > 0 {
+		c = cfg[0]
+	}
+	w := NewWriter(c)
+	w.to = out
+	return w
+}
+
+// StreamOutput returns the factory of an Output which writes every pack
+// as one line of SenML JSON to out, like "stdout:". Register it for a
+// scheme to let a handler write to any io.Writer. out must be safe for
+// concurrent use when several handlers write to it.
+//
+// Example:
+//
+//	var buf bytes.Buffer
+//	_ = RegisterOutput("buffer", StreamOutput(&buf))
+//	handler := New(Config{Out: "buffer:"})
+func StreamOutput(out io.Writer) OutputFactory {
+	return builtinOutput(func(w *Writer) error { return w.SenMl2Stream(out) })
+}
+
+// SenMl2Stream writes the senml.Pack as one line of SenML JSON (NDJSON)
+// to out, independent of the Encoding. Use the Out "stdout:" or "stderr:"
+// to pipe the packs of a handler into tools like jq.
+func (w *Writer) SenMl2Stream(out io.Writer) error {
+	b, err := EncodingJSON.Encode(w.p)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	_, err = out.Write(b)
+	return w.count(len(b), err)
+}
@@ -0,0 +1,62 @@
+package senMlWriter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWriterTo(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriterTo(&buf, WriterConfig{Out: "file:/not/used.json", Encoding: EncodingCBOR})
+	assert.NoError(t, w.AddPack(testPack()).Write())
+	assert.NoError(t, w.AddPack(testPack()).Write())
+	assert.Equal(t, buf.Len(), w.Written())
+
+	// one pack per line in SenML JSON
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+	assert.Len(t, lines, 2)
+	for _, line := range lines {
+		assert.True(t, json.Valid(line))
+		p, err := Decode(line, EncodingJSON)
+		assert.NoError(t, err)
+		assert.Equal(t, testPack().Records, p.Records)
+	}
+}
+
+func TestHandlerWritesStream(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, RegisterOutput("buffer", StreamOutput(&buf)))
+	defer RegisterOutput("buffer", nil)
+
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, Out: "buffer:"})
+	t0 := time.Unix(1714557600, 0)
+	handler.Add(t0, map[string]any{"speed": 80}, "train1/")
+	handler.Add(t0, map[string]any{"speed": 90}, "train2/")
+	assert.NoError(t, handler.Flush())
+	assert.Equal(t, int64(buf.Len()), handler.Stats().Outputs["buffer:"].Bytes)
+	assert.NoError(t, handler.Close())
+
+	var baseNames []string
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		p, err := Decode(scanner.Bytes(), EncodingJSON)
+		assert.NoError(t, err)
+		baseNames = append(baseNames, p.Records[0].BaseName)
+	}
+	assert.Equal(t, []string{"train1/", "train2/"}, baseNames)
+	assert.NoError(t, Config{Out: "stdout:", Outs: []string{"stderr:"}}.Validate())
+}
+
+func TestSenMl2StreamError(t *testing.T) {
+	r, w := io.Pipe()
+	_ = r.Close()
+	writer := NewWriterTo(w)
+	assert.ErrorIs(t, writer.AddPack(testPack()).Write(), io.ErrClosedPipe)
+	assert.Equal(t, 0, writer.Written())
+}
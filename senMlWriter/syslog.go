@@ -1,15 +1,43 @@
 package senMlWriter
 
 import (
+	"crypto/tls"
+	"fmt"
+	"io"
 	"log/slog"
 	"log/syslog"
+	"net"
+	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/mainflux/senml"
 )
 
 const NoTag = "tag_is_not_set"
 
+// SyslogFormat is the message format of syslog outputs.
+type SyslogFormat string
+
+const (
+	// SyslogFormatLegacy is the format of the Go log/syslog package,
+	// every message is terminated by a newline (default)
+	SyslogFormatLegacy SyslogFormat = "legacy"
+
+	// SyslogFormatRFC5424 formats the messages according to RFC 5424
+	// with the base name as structured data. TCP and TLS messages are
+	// framed by octet counting (RFC 6587).
+	SyslogFormatRFC5424 SyslogFormat = "rfc5424"
+)
+
+// syslogTimeout is the timeout for connecting and writing
+const syslogTimeout = 10 * time.Second
+
+// sdID is the structured data id of RFC 5424 messages. 32473 is the
+// private enterprise number reserved for documentation (RFC 5612).
+const sdID = "senml@32473"
+
 // SetPriority sets the priority (severity) of syslog.
 // e.g: w.SetPriority(syslog.LOG_INFO|syslog.LOG_LOCAL7)
 func (w *Writer) SetPriority(p syslog.Priority) *Writer {
@@ -18,11 +46,29 @@ func (w *Writer) SetPriority(p syslog.Priority) *Writer {
 }
 
 // SenMl2Syslog writes the senml.Pack to a syslog server
-// with the given connection string. TCP supported only.
+// with the given connection string.
 // It returns an error if the connection fails or the writing fails.
-// The connection string should be in the form of "syslog://127.0.0.1:7814/senml02
+// The connection string should be in the form of "127.0.0.1:7814/senml02" (TCP)
+// or with scheme "syslog://127.0.0.1:7814/senml02", "syslog+udp://127.0.0.1:514/senml02"
+// and "syslog+tls://collector:6514/senml02".
+// When SyslogMaxSize is set, the pack is split into several packs, each
+// sent as its own syslog message of at most SyslogMaxSize bytes.
 func (w *Writer) SenMl2Syslog(connection string) error {
 
+	network := "tcp"
+	if scheme, rest, found := strings.Cut(connection, "://"); found {
+		switch scheme {
+		case "syslog", "syslog+tcp":
+		case "syslog+udp":
+			network = "udp"
+		case "syslog+tls":
+			network = "tls"
+		default:
+			return ErrUnknownOut
+		}
+		connection = rest
+	}
+
 	tag := NoTag
 
 	left, right, found := strings.Cut(connection, "/")
@@ -31,31 +77,264 @@ func (w *Writer) SenMl2Syslog(connection string) error {
 		tag = right
 	}
 
-	b, err := senml.Encode(w.p, senml.JSON)
+	limit := w.cfg.SyslogMaxSize
+	if limit > 0 {
+		overhead := w.syslogOverhead(network, tag)
+		if overhead >= limit {
+			return fmt.Errorf("%w: SyslogMaxSize %d does not exceed the syslog header of %d bytes",
+				ErrInvalidConfig, limit, overhead)
+		}
+		limit -= overhead
+	}
+
+	messages, err := w.syslogMessages(w.p, limit, limit)
 	if err != nil {
 		return err
 	}
 
-	return w.WriteToSyslog(connection, tag, b)
+	return w.writeToSyslog(network, connection, tag, messages...)
+}
+
+// syslogMessages splits the pack with the budget and encodes the parts.
+// An Envelope adds base64, encryption and a signature to the encoded
+// pack, a message larger than limit is split again with the budget
+// reduced by this growth.
+func (w *Writer) syslogMessages(p senml.Pack, budget, limit int) ([][]byte, error) {
+	packs, err := SplitPack(p, budget, w.cfg.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages [][]byte
+	for _, p := range packs {
+		b, err := w.seal(p)
+		if err != nil {
+			return nil, err
+		}
+		if limit > 0 && len(b) > limit && len(p.Records) > 1 {
+			parts, err := w.syslogMessages(p, max(1, budget*limit/len(b)-1), limit)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, parts...)
+			continue
+		}
+		messages = append(messages, b)
+	}
+	return messages, nil
+}
+
+// syslogOverhead returns the number of bytes the syslog header and the
+// framing add to a message of SyslogMaxSize bytes.
+func (w *Writer) syslogOverhead(network, tag string) int {
+	c := syslogClient{
+		network:  network,
+		format:   w.cfg.SyslogFormat,
+		priority: w.cfg.SyslogPriority,
+		tag:      tag,
+	}
+	c.hostname, _ = os.Hostname()
+
+	size := w.cfg.SyslogMaxSize
+	return len(c.message(w.syslogBaseName(), make([]byte, size))) - size
 }
 
 // WriteToSyslog writes the given data to a syslog server
 // with the given connection string. TCP supported only.
+// Each data slice is sent as its own message over the same connection.
 // It returns an error if the connection fails or the writing fails.
-// The connection string should be in the form of "syslog://127.0.0.1:7814/senml02".
-func (w *Writer) WriteToSyslog(connection, tag string, data []byte) error {
-	writer, err := syslog.Dial("tcp", connection, w.cfg.SyslogPriority, tag)
+// The connection string should be in the form of "127.0.0.1:7814".
+func (w *Writer) WriteToSyslog(connection, tag string, data ...[]byte) error {
+	return w.writeToSyslog("tcp", connection, tag, data...)
+}
+
+// writeToSyslog writes the data with a syslog client. Writers created
+// by a Handler reuse the connection of the handler, all other writers
+// connect for each call.
+func (w *Writer) writeToSyslog(network, address, tag string, data ...[]byte) error {
+	var open = func() (io.Closer, error) {
+		return w.newSyslogClient(network, address, tag)
+	}
 
+	var client io.Closer
+	var err error
+	if w.cfg.conns != nil {
+		key := fmt.Sprintf("syslog+%s://%s/%s?%d", network, address, tag, w.cfg.SyslogPriority)
+		client, err = w.cfg.conns.get(key, open)
+	} else {
+		client, err = open()
+		if err == nil {
+			defer client.Close()
+		}
+	}
 	if err != nil {
 		return err
 	}
-	defer writer.Close()
 
 	if w.cfg.debug {
-		slog.Debug("senMlWriter WriteToSyslog", "connection", connection,
-			"tag", tag, "bytes", len(data))
+		slog.Debug("senMlWriter WriteToSyslog", "network", network, "connection", address,
+			"tag", tag, "messages", len(data))
 	}
 
-	_, err = writer.Write(data)
+	bn := w.syslogBaseName()
+
+	size := 0
+	for _, d := range data {
+		size += len(d)
+	}
+	return w.count(size, client.(*syslogClient).write(bn, data...))
+}
+
+// newSyslogClient creates a syslog client, the connection is established
+// with the first write.
+func (w *Writer) newSyslogClient(network, address, tag string) (*syslogClient, error) {
+	c := &syslogClient{
+		network:  network,
+		address:  address,
+		format:   w.cfg.SyslogFormat,
+		priority: w.cfg.SyslogPriority,
+		tag:      tag,
+	}
+	c.hostname, _ = os.Hostname()
+
+	if network == "tls" {
+		var err error
+		if c.tlsConfig, err = w.cfg.TLS.tlsConfig(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// syslogClient is a syslog connection which reconnects on errors.
+type syslogClient struct {
+	sync.Mutex
+
+	// network is tcp, udp or tls
+	network   string
+	address   string
+	tlsConfig *tls.Config
+
+	format   SyslogFormat
+	priority syslog.Priority
+	tag      string
+	hostname string
+
+	conn net.Conn
+}
+
+// write sends every data slice as its own syslog message.
+func (c *syslogClient) write(baseName string, data ...[]byte) error {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, d := range data {
+		if err := c.send(c.message(baseName, d)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send writes the message. When the connection is broken, send
+// reconnects and retries once.
+func (c *syslogClient) send(msg []byte) error {
+	if c.conn != nil {
+		_ = c.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+		if _, err := c.conn.Write(msg); err == nil {
+			return nil
+		}
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	if _, err := c.conn.Write(msg); err != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+		return err
+	}
+	return nil
+}
+
+// connect dials the syslog server.
+func (c *syslogClient) connect() error {
+	dialer := &net.Dialer{Timeout: syslogTimeout}
+	if c.network == "tls" {
+		conn, err := tls.DialWithDialer(dialer, "tcp", c.address, c.tlsConfig)
+		if err != nil {
+			return err
+		}
+		c.conn = conn
+		return nil
+	}
+
+	conn, err := dialer.Dial(c.network, c.address)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	return nil
+}
+
+// message formats the syslog message including the framing.
+func (c *syslogClient) message(baseName string, data []byte) []byte {
+	if c.format != SyslogFormatRFC5424 {
+		// same format as log/syslog uses for network connections
+		nl := ""
+		if len(data) == 0 || data[len(data)-1] != '\n' {
+			nl = "\n"
+		}
+		return fmt.Appendf(nil, "<%d>%s %s %s[%d]: %s%s", c.priority,
+			time.Now().Format(time.RFC3339), c.hostname, c.tag, os.Getpid(), data, nl)
+	}
+
+	hostname := c.hostname
+	if hostname == "" {
+		hostname = "-"
+	}
+	sd := "-"
+	if baseName != "" {
+		sd = "[" + sdID + ` bn="` + sdEscape(baseName) + `"]`
+	}
+
+	msg := fmt.Appendf(nil, "<%d>1 %s %s %s %d senml %s %s", c.priority,
+		time.Now().Format("2006-01-02T15:04:05.000000Z07:00"), hostname, c.tag, os.Getpid(), sd, data)
+
+	if c.network == "udp" {
+		return msg
+	}
+	// octet counting framing, see RFC 6587 section 3.4.1
+	return append(fmt.Appendf(nil, "%d ", len(msg)), msg...)
+}
+
+// Close closes the connection.
+func (c *syslogClient) Close() error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
 	return err
 }
+
+// syslogBaseName returns the base name of the first record, it is sent
+// as structured data in RFC 5424 messages.
+func (w *Writer) syslogBaseName() string {
+	if len(w.p.Records) == 0 {
+		return ""
+	}
+	return w.p.Records[0].BaseName
+}
+
+// sdEscape escapes '"', '\' and ']' in structured data values.
+func sdEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
@@ -0,0 +1,239 @@
+package senMlWriter
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testSyslogServer receives syslog messages on a random local TCP port.
+type testSyslogServer struct {
+	address  string
+	lines    chan string
+	accepted atomic.Int32
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+// startSyslogServer starts a TCP (or TLS when tlsConfig is set) syslog server.
+// octetCounting reads RFC 6587 octet counted frames instead of lines.
+func startSyslogServer(t *testing.T, tlsConfig *tls.Config, octetCounting bool) *testSyslogServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	s := &testSyslogServer{address: l.Addr().String(), lines: make(chan string, 100)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.accepted.Add(1)
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			go s.read(conn, octetCounting)
+		}
+	}()
+	return s
+}
+
+func (s *testSyslogServer) read(conn net.Conn, octetCounting bool) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		if !octetCounting {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			s.lines <- strings.TrimSuffix(line, "\n")
+			continue
+		}
+		length, err := r.ReadString(' ')
+		if err != nil {
+			return
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(length))
+		if err != nil {
+			return
+		}
+		msg := make([]byte, n)
+		if _, err = io.ReadFull(r, msg); err != nil {
+			return
+		}
+		s.lines <- string(msg)
+	}
+}
+
+// dropConnections closes all accepted connections.
+func (s *testSyslogServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *testSyslogServer) next(t *testing.T) string {
+	select {
+	case line := <-s.lines:
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatal("no syslog message received")
+	}
+	return ""
+}
+
+// selfSignedCertificate creates a certificate for 127.0.0.1 and writes it
+// as CA file into dir.
+func selfSignedCertificate(t *testing.T, dir string) (tls.Certificate, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	assert.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, caFile
+}
+
+func TestHandlerKeepsSyslogConnection(t *testing.T) {
+	server := startSyslogServer(t, nil, false)
+
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, Out: "syslog://" + server.address + "/senml02"})
+	defer handler.Close()
+
+	for i := 0; i < 3; i++ {
+		handler.Add(time.Now(), map[string]any{"speed": float64(i)}, "gps/")
+		assert.NoError(t, handler.Flush())
+		line := server.next(t)
+		assert.Contains(t, line, " senml02[")
+		p, err := ParseSyslog([]byte(line))
+		assert.NoError(t, err)
+		assert.Equal(t, float64(i), *p.Records[0].Value)
+	}
+	assert.Equal(t, int32(1), server.accepted.Load())
+}
+
+func TestHandlerReconnectsSyslog(t *testing.T) {
+	server := startSyslogServer(t, nil, false)
+
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, Out: "syslog://" + server.address + "/senml02"})
+	defer handler.Close()
+
+	handler.Add(time.Now(), map[string]any{"speed": 1.0}, "gps/")
+	assert.NoError(t, handler.Flush())
+	server.next(t)
+
+	server.dropConnections()
+
+	// the first write after the drop may still be accepted by the
+	// local socket, latest the next write must reconnect
+	assert.Eventually(t, func() bool {
+		handler.Add(time.Now(), map[string]any{"speed": 2.0}, "gps/")
+		_ = handler.Flush()
+		return server.accepted.Load() == 2
+	}, 5*time.Second, 50*time.Millisecond)
+
+	line := server.next(t)
+	assert.Contains(t, line, `"v":2`)
+}
+
+func TestSyslogTLSWithRFC5424(t *testing.T) {
+	cert, caFile := selfSignedCertificate(t, t.TempDir())
+	server := startSyslogServer(t, &tls.Config{Certificates: []tls.Certificate{cert}}, true)
+
+	w := NewWriter(WriterConfig{
+		Out:          "syslog+tls://" + server.address + "/senml02",
+		SyslogFormat: SyslogFormatRFC5424,
+		TLS:          TLSConfig{CAFile: caFile},
+	})
+	assert.NoError(t, w.AddPack(testPack()).Write())
+
+	line := server.next(t)
+	assert.True(t, strings.HasPrefix(line, "<190>1 "), line)
+	fields := strings.SplitN(line, " ", 7)
+	assert.Equal(t, "senml02", fields[3])
+	assert.Equal(t, "senml", fields[5])
+	assert.True(t, strings.HasPrefix(fields[6], `[senml@32473 bn="environment/"] [{`), fields[6])
+
+	p, err := ParseSyslog([]byte(line))
+	assert.NoError(t, err)
+	assert.Equal(t, testPack().Records, p.Records)
+}
+
+func TestSyslogTLSUnknownAuthorityFails(t *testing.T) {
+	cert, _ := selfSignedCertificate(t, t.TempDir())
+	server := startSyslogServer(t, &tls.Config{Certificates: []tls.Certificate{cert}}, true)
+
+	w := NewWriter(WriterConfig{Out: "syslog+tls://" + server.address + "/senml02"})
+	assert.Error(t, w.AddPack(testPack()).Write())
+}
+
+func TestSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer pc.Close()
+
+	w := NewWriter(WriterConfig{
+		Out:          "syslog+udp://" + pc.LocalAddr().String() + "/senml02",
+		SyslogFormat: SyslogFormatRFC5424,
+	})
+	assert.NoError(t, w.AddPack(testPack()).Write())
+
+	buf := make([]byte, 65536)
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	assert.NoError(t, err)
+
+	// no octet counting for UDP
+	assert.True(t, strings.HasPrefix(string(buf[:n]), "<190>1 "))
+	p, err := ParseSyslog(buf[:n])
+	assert.NoError(t, err)
+	assert.Equal(t, testPack().Records, p.Records)
+}
+
+func TestSyslogUnknownScheme(t *testing.T) {
+	w := NewWriter(WriterConfig{})
+	assert.ErrorIs(t, w.AddPack(testPack()).SenMl2Syslog("syslog+sctp://127.0.0.1:514/tag"), ErrUnknownOut)
+}
+
+func TestSdEscape(t *testing.T) {
+	assert.Equal(t, `a\"b\\c\]d`, sdEscape(`a"b\c]d`))
+}
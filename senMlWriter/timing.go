@@ -0,0 +1,117 @@
+package senMlWriter
+
+import (
+	"cmp"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/mainflux/senml"
+)
+
+// LatePolicy defines what Add does with a sample older than the Watermark.
+type LatePolicy string
+
+const (
+	// LateReject drops late samples (default)
+	LateReject LatePolicy = "reject"
+
+	// LateClamp sets the time of late samples to the watermark
+	LateClamp LatePolicy = "clamp"
+)
+
+// checkTime applies Watermark and ClockJump to the time of a sample of
+// the base name. It returns the time to use and false when the sample
+// must be dropped. The caller must hold the lock.
+func (h *Handler) checkTime(t time.Time, bn string) (time.Time, bool) {
+	if h.config.Watermark <= 0 && h.config.ClockJump <= 0 {
+		return t, true
+	}
+
+	newest, ok := h.newest[bn]
+	if !ok || t.After(newest) {
+		if jump := time.Duration(h.config.ClockJump) * time.Second; ok && jump > 0 && t.Sub(newest) >= jump {
+			h.clockJump(bn, newest, t)
+		}
+		h.newest[bn] = t
+		return t, true
+	}
+
+	// the clock went back, e.g. NTP after boot: the watermark
+	// restarts, otherwise all following samples would be late
+	if jump := time.Duration(h.config.ClockJump) * time.Second; jump > 0 && newest.Sub(t) >= jump {
+		h.clockJump(bn, newest, t)
+		h.newest[bn] = t
+		return t, true
+	}
+
+	watermark := newest.Add(-time.Duration(h.config.Watermark) * time.Second)
+	if h.config.Watermark <= 0 || !t.Before(watermark) {
+		return t, true
+	}
+
+	h.countLate()
+	if h.debug {
+		slog.Debug("senMlWriter late sample", "baseName", bn, "time", t, "watermark", watermark,
+			"policy", h.config.LatePolicy)
+	}
+	if h.config.LatePolicy == LateClamp {
+		return watermark, true
+	}
+	return t, false
+}
+
+// clockJump logs and counts a clock jump.
+func (h *Handler) clockJump(bn string, newest, t time.Time) {
+	slog.Warn("senMlWriter clock jump detected", "baseName", bn,
+		"newest", newest.Format(time.RFC3339Nano), "time", t.Format(time.RFC3339Nano))
+
+	h.stats.Lock()
+	defer h.stats.Unlock()
+	h.stats.ClockJumps++
+}
+
+// countLate counts a late sample.
+func (h *Handler) countLate() {
+	h.stats.Lock()
+	defer h.stats.Unlock()
+	h.stats.LateSamples++
+}
+
+// sortPack returns the records of the pack sorted by time. The earliest
+// record carries base name and base time, all times are relative to it,
+// so there are no negative times. Records with the same time keep their
+// order. The pack must have a single base name like the packs of a Handler.
+func sortPack(p senml.Pack, precision int) senml.Pack {
+	if len(p.Records) < 2 {
+		return p
+	}
+
+	type timed struct {
+		r   senml.Record
+		abs float64
+	}
+
+	var base senml.Record
+	records := make([]timed, len(p.Records))
+	for i, r := range p.Records {
+		inheritBase(&base, r)
+		r.BaseName, r.BaseTime = "", 0
+		records[i] = timed{r: r, abs: base.BaseTime + r.Time}
+	}
+
+	slices.SortStableFunc(records, func(a, b timed) int {
+		return cmp.Compare(a.abs, b.abs)
+	})
+
+	bt := round(records[0].abs, precision)
+	sorted := make([]senml.Record, len(records))
+	for i, rec := range records {
+		sorted[i] = rec.r
+		sorted[i].Time = round(rec.abs-bt, precision)
+	}
+	sorted[0] = withBase(sorted[0], base)
+	sorted[0].BaseTime = bt
+
+	return senml.Pack{Records: sorted}
+}
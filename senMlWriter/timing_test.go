@@ -0,0 +1,137 @@
+package senMlWriter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mainflux/senml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSortRecords(t *testing.T) {
+	sink := Memory("TestSortRecords")
+	defer sink.Reset()
+
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, Out: "memory:TestSortRecords", SortRecords: true})
+	defer handler.Close()
+
+	// the second sample is older than the first one
+	t0 := time.Unix(1714557600, 0)
+	handler.Add(t0, map[string]any{"speed": 80}, "train/")
+	handler.Add(t0.Add(-2*time.Second), map[string]any{"speed": 70}, "train/")
+	handler.Add(t0.Add(time.Second), map[string]any{"speed": 90}, "train/")
+	assert.NoError(t, handler.Flush())
+
+	packs := sink.Packs()
+	assert.Len(t, packs, 1)
+
+	records := packs[0].Records
+	assert.Equal(t, "train/", records[0].BaseName)
+	assert.Equal(t, float64(t0.Unix()-2), records[0].BaseTime)
+	for i, want := range []float64{0, 2, 3} {
+		assert.Equal(t, want, records[i].Time)
+	}
+
+	samples, err := Samples(packs[0])
+	assert.NoError(t, err)
+	for i, speed := range []float64{70, 80, 90} {
+		assert.Equal(t, speed, samples[i].Data["speed"])
+	}
+}
+
+func TestSortPack(t *testing.T) {
+	var v1, v2, v3 = 1.0, 2.0, 3.0
+	p := senml.Pack{Records: []senml.Record{
+		{BaseName: "bn/", BaseTime: 100, Name: "a", Value: &v1},
+		{Name: "a", Time: -5, Value: &v2},
+		{Name: "b", Time: -5, Value: &v3},
+	}}
+
+	sorted := sortPack(p, 2)
+	assert.Equal(t, "bn/", sorted.Records[0].BaseName)
+	assert.Equal(t, float64(95), sorted.Records[0].BaseTime)
+	assert.Equal(t, []float64{2, 3, 1}, []float64{*sorted.Records[0].Value, *sorted.Records[1].Value, *sorted.Records[2].Value})
+	assert.Equal(t, []float64{0, 0, 5}, []float64{sorted.Records[0].Time, sorted.Records[1].Time, sorted.Records[2].Time})
+	assert.Equal(t, "", sorted.Records[2].BaseName)
+
+	// the original pack is not changed
+	assert.Equal(t, float64(100), p.Records[0].BaseTime)
+}
+
+func TestWatermark(t *testing.T) {
+	t0 := time.Unix(1714557600, 0)
+	tests := []struct {
+		policy LatePolicy
+		want   []float64 // times of the speed samples
+	}{
+		{policy: LateReject, want: []float64{0, 10}},
+		{policy: "", want: []float64{0, 10}},
+		{policy: LateClamp, want: []float64{0, 10, 5}},
+	}
+
+	for _, tt := range tests {
+		handler := New(Config{TimePrecision: 2, FlushInterval: 3600, Out: "memory:TestWatermark",
+			Watermark: 5, LatePolicy: tt.policy})
+
+		handler.Add(t0, map[string]any{"speed": 80}, "train/")
+		handler.Add(t0.Add(10*time.Second), map[string]any{"speed": 90}, "train/")
+		// late: 3s older than the watermark at t0+5s
+		handler.Add(t0.Add(2*time.Second), map[string]any{"speed": 85}, "train/")
+		// not late: within the watermark
+		handler.Add(t0.Add(6*time.Second), map[string]any{"temp": 20}, "train/")
+
+		handler.Lock()
+		samples, err := Samples(handler.packs["train/"])
+		handler.Unlock()
+		assert.NoError(t, err)
+
+		var times []float64
+		for _, s := range samples {
+			if _, ok := s.Data["speed"]; ok {
+				times = append(times, float64(s.Time.Unix()-t0.Unix()))
+			}
+		}
+		assert.Equal(t, tt.want, times, tt.policy)
+		assert.Equal(t, int64(1), handler.Stats().LateSamples, tt.policy)
+		assert.Equal(t, int64(0), handler.Stats().ClockJumps, tt.policy)
+
+		handler.Lock()
+		handler.packs = make(map[string]senml.Pack)
+		handler.Unlock()
+		assert.NoError(t, handler.Close())
+	}
+}
+
+func TestClockJump(t *testing.T) {
+	handler := New(Config{TimePrecision: 2, FlushInterval: 3600, Out: "memory:TestClockJump",
+		Watermark: 5, ClockJump: 3600})
+	defer Memory("TestClockJump").Reset()
+	defer handler.Close()
+
+	t0 := time.Unix(1714557600, 0)
+	handler.Add(t0, map[string]any{"speed": 80}, "train/")
+
+	// the clock went back by a day: not late, the watermark restarts
+	back := t0.Add(-24 * time.Hour)
+	handler.Add(back, map[string]any{"speed": 70}, "train/")
+	handler.Add(back.Add(time.Second), map[string]any{"speed": 71}, "train/")
+	assert.Equal(t, int64(1), handler.Stats().ClockJumps)
+	assert.Equal(t, int64(0), handler.Stats().LateSamples)
+
+	// the clock went forward by two hours
+	handler.Add(back.Add(2*time.Hour), map[string]any{"speed": 72}, "train/")
+	assert.Equal(t, int64(2), handler.Stats().ClockJumps)
+
+	// samples older than the new watermark are late again
+	handler.Add(back.Add(2*time.Hour-10*time.Second), map[string]any{"speed": 73}, "train/")
+	assert.Equal(t, int64(1), handler.Stats().LateSamples)
+
+	handler.Lock()
+	assert.Len(t, handler.packs["train/"].Records, 4)
+	handler.Unlock()
+
+	// other base names are not affected
+	handler.Add(t0, map[string]any{"temp": 20}, "wagon/")
+	assert.Equal(t, int64(2), handler.Stats().ClockJumps)
+	assert.NoError(t, handler.Flush())
+}
@@ -0,0 +1,51 @@
+package senMlWriter
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+)
+
+// TLSConfig holds the certificates used by encrypted outputs.
+// All files are PEM encoded. Empty fields use the system defaults.
+type TLSConfig struct {
+	// CAFile is the certificate authority used to verify the server
+	CAFile string `json:"caFile" yaml:"caFile"`
+
+	// CertFile and KeyFile are the client certificate and its private key
+	CertFile string `json:"certFile" yaml:"certFile"`
+	KeyFile  string `json:"keyFile" yaml:"keyFile"`
+
+	// InsecureSkipVerify disables the server certificate verification.
+	// Use it for testing only.
+	InsecureSkipVerify bool `json:"insecureSkipVerify" yaml:"insecureSkipVerify"`
+}
+
+// tlsConfig creates a *tls.Config from the configured files.
+func (c TLSConfig) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		b, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(b) {
+			return nil, errors.New("no certificate found in " + c.CAFile)
+		}
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,87 @@
+package senMlWriter
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/mainflux/senml"
+
+	"github.com/itdesign-at/golib/keyvalue"
+)
+
+// RecordMeta holds optional SenML fields for a key added with AddWithMeta.
+type RecordMeta struct {
+	// Unit is the SenML unit of the value, e.g. "Cel", "m/s" or "%RH".
+	// See RFC 8428 section 12.1 for the registered units.
+	Unit string `json:"unit" yaml:"unit"`
+
+	// Sum writes a numeric value as SenML Sum instead of Value.
+	// Use it for counters which integrate a value over time.
+	Sum bool `json:"sum" yaml:"sum"`
+}
+
+// setValue sets the SenML value field matching the Go type of v:
+//
+//	bool      -> BoolValue (vb)
+//	string    -> StringValue (vs)
+//	[]byte    -> DataValue (vd), base64 URL encoded without padding
+//	numbers   -> Value (v) or Sum (s) when configured in meta
+//
+// Values of other types are converted with keyvalue.Record.Float64.
+func setValue(r *senml.Record, v any, meta RecordMeta) {
+	r.Unit = meta.Unit
+
+	switch val := v.(type) {
+	case bool:
+		r.BoolValue = &val
+		return
+	case string:
+		r.StringValue = &val
+		return
+	case []byte:
+		s := base64.RawURLEncoding.EncodeToString(val)
+		r.DataValue = &s
+		return
+	}
+
+	f := toFloat64(v)
+	if meta.Sum {
+		r.Sum = &f
+	} else {
+		r.Value = &f
+	}
+}
+
+// toFloat64 converts all numeric types to float64.
+func toFloat64(v any) float64 {
+	switch val := v.(type) {
+	case float64:
+		return val
+	case float32:
+		return float64(val)
+	case int:
+		return float64(val)
+	case int8:
+		return float64(val)
+	case int16:
+		return float64(val)
+	case int32:
+		return float64(val)
+	case int64:
+		return float64(val)
+	case uint:
+		return float64(val)
+	case uint8:
+		return float64(val)
+	case uint16:
+		return float64(val)
+	case uint32:
+		return float64(val)
+	case uint64:
+		return float64(val)
+	case json.Number:
+		f, _ := val.Float64()
+		return f
+	}
+	return keyvalue.Record{"v": v}.Float64("v", true)
+}
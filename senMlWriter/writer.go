@@ -3,6 +3,7 @@ package senMlWriter
 import (
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"log/syslog"
 	"strings"
@@ -16,7 +17,8 @@ var ErrUnknownOut = errors.New("unknown Out format")
 // The configuration is used to create a new Sensorml handler.
 // The handler is used to add data to the Sensorml handler.
 // The handler writes the data to the configured Out every minute.
-// The Out should be in the form of "file:/tmp/astrolab%02d.json" or "syslog://localhost:5514/tag".
+// The Out should be in the form of "file:/tmp/astrolab%02d.json", "syslog://localhost:5514/tag",
+// "mqtt://broker:1883/topic/{{.baseName}}" or "nats://localhost:4222/subject.{{.baseName}}".
 // The base name is used as the base name for the senml records.
 // The debug flag is used to enable debug logging.
 // The args are used to pass additional key value pairs to the handler.
@@ -30,12 +32,54 @@ type WriterConfig struct {
 
 	SyslogPriority syslog.Priority `json:"syslogPriority" yaml:"syslogPriority"`
 
+	// File holds the options for "file:" outputs
+	File FileConfig `json:"file" yaml:"file"`
+
+	// MQTT holds the options for "mqtt://" and "mqtts://" outputs
+	MQTT MQTTConfig `json:"mqtt" yaml:"mqtt"`
+
+	// SyslogMaxSize is the maximum size in bytes of one syslog message,
+	// header, framing and an Envelope included. Larger packs are split.
+	// 0 means unlimited.
+	SyslogMaxSize int `json:"syslogMaxSize" yaml:"syslogMaxSize"`
+
+	// SyslogFormat is legacy (default) or rfc5424
+	SyslogFormat SyslogFormat `json:"syslogFormat" yaml:"syslogFormat"`
+
+	// Encoding is the format of the pack: json (default), cbor, xml or jsonl
+	Encoding Encoding `json:"encoding" yaml:"encoding"`
+
+	// NATS holds the options for "nats://" outputs
+	NATS NATSConfig `json:"nats" yaml:"nats"`
+
+	// HTTP holds the options for "http://" and "https://" outputs
+	HTTP HTTPConfig `json:"http" yaml:"http"`
+
+	// TLS holds the certificates for encrypted outputs
+	TLS TLSConfig `json:"tls" yaml:"tls"`
+
+	// Envelope encrypts and signs the packs of "file:" and syslog outputs
+	Envelope EnvelopeConfig `json:"envelope" yaml:"envelope"`
+
+	// conns holds the connections of the handler, nil for a standalone writer
+	conns *connections
+
+	// handler is true for the writers of a Handler, they do not wait
+	// for retries while the handler is locked
+	handler bool
+
 	debug bool
 }
 
 type Writer struct {
 	cfg WriterConfig
 	p   senml.Pack
+
+	// written counts the bytes written successfully
+	written int
+
+	// to is the stream of a writer created by NewWriterTo
+	to io.Writer
 }
 
 // NewWriter creates a new Writer with the given configuration and current time.
@@ -67,24 +111,46 @@ func (w *Writer) AddPack(p senml.Pack) *Writer {
 
 // Write writes the senml.Pack to the configured Out.
 // It returns an error if the writing fails.
-// The Out should be in the form of "file:/tmp/astrolab%02d.json" or "syslog://localhost:5514/tag".
+// The Out should be in the form of "file:/tmp/astrolab%02d.json", "syslog://localhost:5514/tag",
+// "mqtt://broker:1883/topic/{{.baseName}}", "nats://localhost:4222/subject.{{.baseName}}"
+// or "https://iot.example.com/api/senml/{{.baseName}}".
+// "stdout:" and "stderr:" write one pack per line, see SenMl2Stream.
+// Every scheme is written by the Output registered for it, see RegisterOutput.
+// A writer created by NewWriterTo writes to its stream.
 func (w *Writer) Write() error {
-	var err error
+	if w.to != nil {
+		return w.SenMl2Stream(w.to)
+	}
+
 	// w.cfg.Out examples:
 	// file:/tmp/astrolab%02d.json
+	// influx:/tmp/astrolab%02d.lp
+	// csv:/tmp/astrolab%02d.csv
 	// syslog://localhost:5514/tag
-	left, right, _ := strings.Cut(w.cfg.Out, ":")
-	switch left {
-	case "file":
-		_, err = w.SenMl2File(right)
-	case "syslog":
-		connection := strings.TrimPrefix(right, "//")
-		err = w.SenMl2Syslog(connection)
-	default:
-		err = ErrUnknownOut
-	}
+	// syslog+udp://localhost:514/tag
+	// syslog+tls://localhost:6514/tag
+	// mqtt://broker:1883/topic/{{.baseName}}
+	// nats://localhost:4222/subject.{{.baseName}}
+	// https://iot.example.com/api/senml/{{.baseName}}
+	// stdout:
+	scheme, _, _ := strings.Cut(w.cfg.Out, ":")
+	err := w.writeOutput(scheme)
 	if w.cfg.debug {
-		slog.Debug("senMlWriter Write", "finished", "error", fmt.Sprintf("%v", err))
+		slog.Debug("senMlWriter Write finished", "error", fmt.Sprintf("%v", err))
+	}
+	return err
+}
+
+// Written returns the number of bytes written successfully by the writer,
+// the encoded (and compressed) packs without protocol overhead.
+func (w *Writer) Written() int {
+	return w.written
+}
+
+// count adds n to the written bytes when err is nil and returns err.
+func (w *Writer) count(n int, err error) error {
+	if err == nil {
+		w.written += n
 	}
 	return err
 }